@@ -0,0 +1,152 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/* authorize checks that a request to the API may be served, before anything
+ * else is done with it. The API acts with the user's Vanadium credentials, so
+ * it must not be usable by any web page the user visits, nor by anyone else
+ * who can reach its port:
+ *
+ * A request must be addressed to one of the hosts namespace-browserd is
+ * configured to be reached as (see hostAllowed), so that a page of another
+ * site cannot reach it by rebinding its DNS name to the daemon's address.
+ *
+ * A request made by a web page, i.e. with an Origin header, must come from
+ * the page of the app, or from one of config.AllowedOrigins.
+ *
+ * Every request must present the secret token of this launch of the daemon,
+ * in an "Authorization: Bearer <token>" header or in the token query
+ * parameter, since EventSources and WebSockets cannot set headers. The app
+ * reads it from its client config, which other origins cannot read.
+ *
+ * CORS preflight requests from allowed origins are answered here. authorize
+ * returns false if it has responded to the request.
+ */
+func (b *NamespaceBrowser) authorize(rw http.ResponseWriter, req *http.Request) bool {
+	if !b.config.hostAllowed(req.Host) {
+		writeJSON(rw, http.StatusForbidden, errorReturn{Err: "host " + req.Host + " is not allowed"})
+		return false
+	}
+	if origin := req.Header.Get("Origin"); origin != "" {
+		if !b.config.originAllowed(origin) {
+			writeJSON(rw, http.StatusForbidden, errorReturn{Err: "origin " + origin + " is not allowed"})
+			return false
+		}
+		rw.Header().Set("Access-Control-Allow-Origin", origin)
+		rw.Header().Add("Vary", "Origin")
+		if req.Method == "OPTIONS" {
+			rw.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			rw.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			rw.Header().Set("Access-Control-Expose-Headers", "X-Browser-Profile, X-Namespace-Roots")
+			rw.WriteHeader(http.StatusNoContent)
+			return false
+		}
+	}
+
+	token := req.URL.Query().Get("token")
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(b.config.token)) != 1 {
+		writeJSON(rw, http.StatusUnauthorized, errorReturn{Err: "missing or wrong API token"})
+		return false
+	}
+	return true
+}
+
+// originAllowed returns true if a web page from origin may use the API: if it
+// is the page of the app, i.e. it has the scheme the app is served with and
+// the host of WebServerAddress or of one of AllowedHosts, as matched by
+// sameHost, or if it is one of AllowedOrigins. The Host of the request is not
+// trusted, since a page that rebinds its DNS name controls it.
+func (c *config) originAllowed(origin string) bool {
+	scheme := "http"
+	if c.useTLS() {
+		scheme = "https"
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Scheme, scheme) && u.Host != "" {
+		for _, host := range append([]string{c.WebServerAddress}, c.AllowedHosts...) {
+			if c.sameHost(u.Host, host) {
+				return true
+			}
+		}
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// hostAllowed returns true if host, the Host of a request, is one that the
+// servers are configured to be reached as: WebServerAddress, ServerAddress,
+// the hosts of APIURL and WebSocketURL, or one of AllowedHosts. An address
+// without a host, or with localhost or an unspecified one such as 0.0.0.0,
+// is reached as localhost or a loopback IP.
+func (c *config) hostAllowed(host string) bool {
+	hosts := append([]string{c.WebServerAddress, c.ServerAddress}, c.AllowedHosts...)
+	for _, u := range []string{c.APIURL, c.WebSocketURL} {
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			hosts = append(hosts, parsed.Host)
+		}
+	}
+	for _, allowed := range hosts {
+		if c.sameHost(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameHost returns true if the Host of a request is the configured address.
+// A Host without a port has the default port of the scheme.
+func (c *config) sameHost(host, addr string) bool {
+	defaultPort := "80"
+	if c.useTLS() {
+		defaultPort = "443"
+	}
+	splitHost := func(hostport string) (string, string) {
+		h, port, err := net.SplitHostPort(hostport)
+		if err != nil {
+			h, port = strings.Trim(hostport, "[]"), defaultPort
+		}
+		return strings.ToLower(h), port
+	}
+	reqHost, reqPort := splitHost(host)
+	addrHost, addrPort := splitHost(addr)
+	if reqPort != addrPort {
+		return false
+	}
+	if ip := net.ParseIP(addrHost); addrHost == "" || addrHost == "localhost" || (ip != nil && ip.IsUnspecified()) {
+		return reqHost == "localhost" || net.ParseIP(reqHost).IsLoopback()
+	}
+	return reqHost == addrHost
+}
+
+// stringList is a flag.Value of comma-separated strings.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
+}
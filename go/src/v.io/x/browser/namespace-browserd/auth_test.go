@@ -0,0 +1,163 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameHost(t *testing.T) {
+	tests := []struct {
+		tls        bool
+		host, addr string
+		want       bool
+	}{
+		{false, "localhost:9001", "localhost:9001", true},
+		{false, "127.0.0.1:9001", "localhost:9001", true},
+		{false, "[::1]:9001", "localhost:9001", true},
+		{false, "127.0.0.1:9001", ":9001", true},
+		{false, "localhost:9001", "0.0.0.0:9001", true},
+		{false, "LocalHost:9001", "localhost:9001", true},
+		{false, "localhost:9002", "localhost:9001", false},
+		{false, "10.0.0.1:9001", ":9001", false},
+		// A page of another site that rebinds its name to the daemon.
+		{false, "evil.example.com:9001", "localhost:9001", false},
+		{false, "evil.example.com:9001", ":9001", false},
+		{false, "browser.example.com:9001", "browser.example.com:9001", true},
+		{false, "Browser.Example.com:9001", "browser.example.com:9001", true},
+		{false, "other.example.com:9001", "browser.example.com:9001", false},
+		// A Host without a port has the default port of the scheme.
+		{false, "browser.example.com", "browser.example.com:80", true},
+		{false, "browser.example.com", "browser.example.com:443", false},
+		{true, "browser.example.com", "browser.example.com:443", true},
+		{true, "browser.example.com", "browser.example.com:80", false},
+		{false, "[::1]", "localhost:80", true},
+	}
+	for _, test := range tests {
+		c := &config{TLSSelfSigned: test.tls}
+		if got := c.sameHost(test.host, test.addr); got != test.want {
+			t.Errorf("sameHost(%q, %q) with TLS %v: got %v, want %v", test.host, test.addr, test.tls, got, test.want)
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	defaults := &config{ServerAddress: "localhost:9002", WebServerAddress: "localhost:9001"}
+	webAddr := &config{ServerAddress: "localhost:9002", WebServerAddress: ":9001"}
+	allowed := &config{
+		ServerAddress:    "localhost:9002",
+		WebServerAddress: "localhost:9001",
+		AllowedHosts:     stringList{"browser.example.com:9001"},
+		APIURL:           "http://api.example.com:8080/api",
+		WebSocketURL:     "ws://ws.example.com:8081/api/ws",
+	}
+	tests := []struct {
+		c    *config
+		host string
+		want bool
+	}{
+		{defaults, "localhost:9001", true},
+		{defaults, "127.0.0.1:9001", true},
+		{defaults, "localhost:9002", true},
+		{defaults, "127.0.0.1:9002", true},
+		{defaults, "localhost:9003", false},
+		{defaults, "evil.example.com:9001", false},
+		{defaults, "", false},
+		{webAddr, "127.0.0.1:9001", true},
+		{webAddr, "localhost:9001", true},
+		{webAddr, "evil.example.com:9001", false},
+		{allowed, "browser.example.com:9001", true},
+		{allowed, "api.example.com:8080", true},
+		{allowed, "ws.example.com:8081", true},
+		{allowed, "api.example.com:8081", false},
+		{allowed, "evil.example.com:9001", false},
+	}
+	for _, test := range tests {
+		if got := test.c.hostAllowed(test.host); got != test.want {
+			t.Errorf("hostAllowed(%q) with %+v: got %v, want %v", test.host, test.c, got, test.want)
+		}
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	defaults := &config{WebServerAddress: "localhost:9001"}
+	webAddr := &config{WebServerAddress: ":9001"}
+	withTLS := &config{WebServerAddress: "browser.example.com:443", TLSSelfSigned: true}
+	listed := &config{
+		WebServerAddress: "localhost:9001",
+		AllowedHosts:     stringList{"browser.example.com:9001"},
+		AllowedOrigins:   stringList{"http://dev.example.com:3000/"},
+	}
+	any := &config{WebServerAddress: "localhost:9001", AllowedOrigins: stringList{"*"}}
+	tests := []struct {
+		c      *config
+		origin string
+		want   bool
+	}{
+		{defaults, "http://localhost:9001", true},
+		{defaults, "http://127.0.0.1:9001", true},
+		{defaults, "http://LOCALHOST:9001", true},
+		{defaults, "https://localhost:9001", false},
+		{defaults, "http://localhost:9002", false},
+		{defaults, "http://evil.example.com:9001", false},
+		{defaults, "null", false},
+		{defaults, "localhost:9001", false},
+		{webAddr, "http://127.0.0.1:9001", true},
+		{webAddr, "http://evil.example.com:9001", false},
+		{withTLS, "https://browser.example.com", true},
+		{withTLS, "http://browser.example.com", false},
+		{listed, "http://browser.example.com:9001", true},
+		{listed, "http://dev.example.com:3000", true},
+		{listed, "http://dev.example.com:3001", false},
+		{listed, "https://dev.example.com:3000", false},
+		{any, "http://evil.example.com", true},
+	}
+	for _, test := range tests {
+		if got := test.c.originAllowed(test.origin); got != test.want {
+			t.Errorf("originAllowed(%q) with %+v: got %v, want %v", test.origin, test.c, got, test.want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	b := &NamespaceBrowser{config: &config{
+		ServerAddress:    "localhost:9002",
+		WebServerAddress: "localhost:9001",
+		token:            "secret",
+	}}
+	tests := []struct {
+		method, url, host, origin, auth string
+		want                            int
+	}{
+		{"GET", "/api/glob?token=secret", "localhost:9002", "", "", http.StatusOK},
+		{"GET", "/api/glob", "localhost:9002", "", "Bearer secret", http.StatusOK},
+		{"GET", "/api/glob", "localhost:9002", "http://localhost:9001", "Bearer secret", http.StatusOK},
+		{"GET", "/api/glob", "localhost:9002", "", "", http.StatusUnauthorized},
+		{"GET", "/api/glob?token=wrong", "localhost:9002", "", "", http.StatusUnauthorized},
+		{"GET", "/api/glob", "localhost:9002", "", "Bearer wrong", http.StatusUnauthorized},
+		{"GET", "/api/glob?token=secret", "evil.example.com:9002", "", "", http.StatusForbidden},
+		{"GET", "/api/glob?token=secret", "localhost:9002", "http://evil.example.com", "", http.StatusForbidden},
+		// Preflight requests are answered without a token.
+		{"OPTIONS", "/api/glob", "localhost:9002", "http://localhost:9001", "", http.StatusNoContent},
+		{"OPTIONS", "/api/glob", "localhost:9002", "http://evil.example.com", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		req.Host = test.host
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rw := httptest.NewRecorder()
+		ok := b.authorize(rw, req)
+		if got := rw.Code; got != test.want || ok != (test.want == http.StatusOK) {
+			t.Errorf("%s %s, host %q, origin %q: got %d (%v), want %d", test.method, test.url, test.host, test.origin, got, ok, test.want)
+		}
+	}
+}
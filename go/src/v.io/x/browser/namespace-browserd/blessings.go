@@ -0,0 +1,151 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/rpc"
+	"v.io/v23/security"
+	"v.io/v23/vom"
+)
+
+/* blessingChain describes one certificate chain of a set of blessings, i.e.
+ * one blessing name:
+ *
+ * { name: <string>, certificates: []{ extension: <string>,
+ *   issuer: <string>, publicKey: <string>, caveats: []{ description: <string>,
+ *   expiry: <time> } }, expiry: <time> }
+ *
+ * The certificates are ordered from the root. Each one is issued by the
+ * blessing named by the ones before it; the issuer of the root is empty,
+ * since it is self-signed. The expiry of the chain is the earliest of its
+ * expiry caveats, and is omitted if it has none.
+ */
+type blessingChain struct {
+	Name         string            `json:"name"`
+	Certificates []certificateInfo `json:"certificates"`
+	Expiry       *time.Time        `json:"expiry,omitempty"`
+}
+
+type certificateInfo struct {
+	Extension string       `json:"extension"`
+	Issuer    string       `json:"issuer"`
+	PublicKey string       `json:"publicKey"`
+	Caveats   []caveatInfo `json:"caveats"`
+}
+
+type caveatInfo struct {
+	Description string     `json:"description"`
+	Expiry      *time.Time `json:"expiry,omitempty"` // Set for expiry caveats.
+}
+
+// rejectedBlessing is a blessing name of the server that the client does not
+// accept, with the reason why.
+type rejectedBlessing struct {
+	Blessing string `json:"blessing"`
+	Reason   string `json:"reason"`
+}
+
+// remoteBlessings returns the blessings that the server at name presents.
+func (b *NamespaceBrowser) remoteBlessings(ctx *context.T, name string) (blessingsReturn, error) {
+	call, err := v23.GetClient(ctx).StartCall(ctx, name, rpc.ReservedMethodSignature, nil)
+	if err != nil {
+		return blessingsReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	defer call.Finish()
+
+	names, rejected := security.RemoteBlessingNames(ctx, call.Security())
+	_, blessings := call.RemoteBlessings()
+	res := blessingsReturn{
+		Blessings: names,
+		Chains:    describeBlessings(blessings),
+		Rejected:  []rejectedBlessing{},
+	}
+	if res.Blessings == nil {
+		res.Blessings = []string{}
+	}
+	if key := blessings.PublicKey(); key != nil {
+		res.PublicKey = key.String()
+	}
+	for _, r := range rejected {
+		res.Rejected = append(res.Rejected, rejectedBlessing{Blessing: r.Blessing, Reason: fmt.Sprintf("%v", r.Err)})
+	}
+	return res, nil
+}
+
+// describeBlessings describes each certificate chain of a set of blessings.
+func describeBlessings(blessings security.Blessings) []blessingChain {
+	chains := []blessingChain{}
+	for _, certs := range security.MarshalBlessings(blessings).CertificateChains {
+		chain := blessingChain{Certificates: []certificateInfo{}}
+		var extensions []string
+		for _, cert := range certs {
+			info := certificateInfo{
+				Extension: cert.Extension,
+				Issuer:    strings.Join(extensions, security.ChainSeparator),
+				PublicKey: publicKeyString(cert.PublicKey),
+				Caveats:   []caveatInfo{},
+			}
+			for _, caveat := range cert.Caveats {
+				c := describeCaveat(caveat)
+				if c.Expiry != nil && (chain.Expiry == nil || c.Expiry.Before(*chain.Expiry)) {
+					chain.Expiry = c.Expiry
+				}
+				info.Caveats = append(info.Caveats, c)
+			}
+			chain.Certificates = append(chain.Certificates, info)
+			extensions = append(extensions, cert.Extension)
+		}
+		chain.Name = strings.Join(extensions, security.ChainSeparator)
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// describeCaveat describes the caveats defined by v23/security in words, and
+// others by their ID.
+func describeCaveat(caveat security.Caveat) caveatInfo {
+	switch caveat.Id {
+	case security.ExpiryCaveat.Id:
+		var expiry time.Time
+		if err := vom.Decode(caveat.ParamVom, &expiry); err == nil {
+			return caveatInfo{Description: fmt.Sprintf("expires at %v", expiry.UTC()), Expiry: &expiry}
+		}
+	case security.MethodCaveat.Id:
+		var methods []string
+		if err := vom.Decode(caveat.ParamVom, &methods); err == nil {
+			return caveatInfo{Description: fmt.Sprintf("only for methods %s", strings.Join(methods, ", "))}
+		}
+	case security.ConstCaveat.Id:
+		var valid bool
+		if err := vom.Decode(caveat.ParamVom, &valid); err == nil {
+			if valid {
+				return caveatInfo{Description: "always valid"}
+			}
+			return caveatInfo{Description: "never valid"}
+		}
+	case security.PublicKeyThirdPartyCaveat.Id:
+		if tp := caveat.ThirdPartyDetails(); tp != nil {
+			return caveatInfo{Description: fmt.Sprintf("requires a discharge of third-party caveat %s", tp.ID())}
+		}
+	}
+	return caveatInfo{Description: caveat.String()}
+}
+
+// publicKeyString returns the fingerprint of a DER-encoded public key, or its
+// hex encoding if it cannot be decoded.
+func publicKeyString(der []byte) string {
+	key, err := security.UnmarshalPublicKey(der)
+	if err != nil {
+		return hex.EncodeToString(der)
+	}
+	return key.String()
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+)
+
+// How many results the cache holds at most. Once it is full, new results are
+// not cached until others expire.
+const maxCacheEntries = 10000
+
+// nsCache holds the results of globs, resolves and signatures, shared by all
+// the clients of namespace-browserd. Results are keyed by their kind, the
+// scope of the request, i.e. its profile and namespace roots, and the name or
+// pattern. They expire after config.CacheTTL, or earlier if a server they
+// list is mounted for less time. Expired results are swept out at most every
+// TTL, when results are added.
+type nsCache struct {
+	ttl time.Duration // If zero, nothing is cached.
+
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry // GUARDED_BY(mu)
+	hits      map[string]uint64      // By kind. GUARDED_BY(mu)
+	misses    map[string]uint64      // By kind. GUARDED_BY(mu)
+	lastSweep time.Time              // GUARDED_BY(mu)
+}
+
+type cacheEntry struct {
+	kind    string
+	root    string // The name, or the part of the pattern without wildcards.
+	value   interface{}
+	expires time.Time
+}
+
+// cacheStats are the statistics of the cache, by kind.
+type cacheStats struct {
+	Hits    map[string]uint64 `json:"hits"`
+	Misses  map[string]uint64 `json:"misses"`
+	Entries map[string]int    `json:"entries"`
+}
+
+// clearCacheParams are the params of clearCache. If Name is empty, the whole
+// cache is cleared.
+type clearCacheParams struct {
+	Name string `json:"name"`
+}
+
+func newNSCache(ttl time.Duration) *nsCache {
+	return &nsCache{
+		ttl:     ttl,
+		entries: map[string]*cacheEntry{},
+		hits:    map[string]uint64{},
+		misses:  map[string]uint64{},
+	}
+}
+
+// cacheScope returns the scope of the results of a request: what it sees
+// depends on its profile and namespace roots.
+func cacheScope(ctx *context.T) string {
+	return profileOf(ctx) + "|" + strings.Join(v23.GetNamespace(ctx).Roots(), ",")
+}
+
+func cacheKey(kind, scope, name string) string {
+	return kind + "|" + scope + "|" + name
+}
+
+// get returns the value cached for a name or pattern, if it has not expired.
+func (c *nsCache) get(kind, scope, name string) (interface{}, bool) {
+	if c.ttl == 0 {
+		return nil, false
+	}
+	key := cacheKey(kind, scope, name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.misses[kind]++
+		return nil, false
+	}
+	c.hits[kind]++
+	return entry.value, true
+}
+
+// put caches a value until the earliest of the cache TTL and the deadlines
+// of the given servers. If the cache is full, the value is not cached.
+func (c *nsCache) put(kind, scope, name, root string, value interface{}, servers []naming.MountedServer) {
+	if c.ttl == 0 {
+		return
+	}
+	now := time.Now()
+	expires := now.Add(c.ttl)
+	for _, s := range servers {
+		if d := s.Deadline.Time; !d.IsZero() && d.Before(expires) {
+			expires = d
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastSweep) >= c.ttl || len(c.entries) >= maxCacheEntries {
+		c.sweep(now)
+	}
+	key := cacheKey(kind, scope, name)
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		return
+	}
+	c.entries[key] = &cacheEntry{kind: kind, root: root, value: value, expires: expires}
+}
+
+// sweep removes the expired results. c.mu must be held.
+func (c *nsCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastSweep = now
+}
+
+// invalidate removes the results that a change to name may affect: those of
+// name, of its ancestors, which may list it, and of its descendants. If name
+// is empty, everything is removed.
+func (c *nsCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if name == "" || entry.root == "" || entry.root == name ||
+			strings.HasPrefix(name, entry.root+"/") || strings.HasPrefix(entry.root, name+"/") {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *nsCache) stats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := cacheStats{
+		Hits:    map[string]uint64{},
+		Misses:  map[string]uint64{},
+		Entries: map[string]int{},
+	}
+	for kind, n := range c.hits {
+		stats.Hits[kind] = n
+	}
+	for kind, n := range c.misses {
+		stats.Misses[kind] = n
+	}
+	now := time.Now()
+	for _, entry := range c.entries {
+		if now.Before(entry.expires) {
+			stats.Entries[entry.kind]++
+		}
+	}
+	return stats
+}
+
+// cachedGlob is streamGlob for glob requests: the responses of a glob that
+// completed are cached, and sent again to the globs of the same pattern,
+// options and scope until they expire.
+func (b *NamespaceBrowser) cachedGlob(ctx *context.T, params globParams, opts requestOptions, send func(globReturn)) error {
+	key, _ := json.Marshal(params)
+	scope := cacheScope(ctx)
+	if cached, ok := b.cache.get("glob", scope, string(key)); ok {
+		for _, res := range cached.([]globReturn) {
+			send(res)
+		}
+		return nil
+	}
+
+	var responses []globReturn
+	var servers []naming.MountedServer
+	failed := false
+	err := b.streamGlob(ctx, params, opts, func(res globReturn) {
+		responses = append(responses, res)
+		if res.GlobRes != nil {
+			servers = append(servers, res.GlobRes.Servers...)
+		}
+		if res.Err != "" {
+			failed = true
+		}
+		send(res)
+	})
+	// A glob that was cut short by its context is incomplete.
+	if err == nil && !failed && ctx.Err() == nil {
+		b.cache.put("glob", scope, string(key), globRoot(params.Pattern), responses, servers)
+	}
+	return err
+}
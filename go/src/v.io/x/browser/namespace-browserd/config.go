@@ -0,0 +1,267 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// The path of the API in single-port mode.
+	API_PATH = "/api"
+
+	// The path, relative to the web server, at which the JS app learns where
+	// the API is.
+	CLIENT_CONFIG_PATH = "/config.json"
+)
+
+// config holds the settings of a namespace-browserd instance.
+// Every field can be given as a flag or in the JSON config file named by
+// -config. Flags set on the command line take precedence over the file.
+type config struct {
+	ServerAddress    string   `json:"serverAddress"`
+	WebServerAddress string   `json:"webServerAddress"`
+	HTMLDir          string   `json:"htmlDir"`
+	RPCTimeout       duration `json:"rpcTimeout"`
+
+	// Timeouts overrides RPCTimeout for some request types, e.g. glob. The
+	// timeout a request asks for is kept within MinTimeout and MaxTimeout.
+	Timeouts   durationMap `json:"timeouts"`
+	MinTimeout duration    `json:"minTimeout"`
+	MaxTimeout duration    `json:"maxTimeout"`
+
+	// Requests may ask to be retried after transient errors, at most
+	// MaxRetries times. The wait between tries starts at RetryBackoff and
+	// doubles each time.
+	MaxRetries   int      `json:"maxRetries"`
+	RetryBackoff duration `json:"retryBackoff"`
+
+	// How long the results of globs, resolves and signatures are cached. If
+	// zero, nothing is cached.
+	CacheTTL duration `json:"cacheTTL"`
+
+	// How many sets of namespace roots, besides the default ones, are kept
+	// for requests. The least recently used ones are dropped for new ones.
+	// See namespaces.
+	MaxRootSets int `json:"maxRootSets"`
+
+	// Profiles are credentials directories, by name, that requests may act
+	// as instead of the credentials of the daemon.
+	Profiles stringMap `json:"profiles"`
+
+	// How often a watch globs the namespace, unless it asks for another
+	// interval. It may not ask for less than MinWatchInterval.
+	WatchInterval    duration `json:"watchInterval"`
+	MinWatchInterval duration `json:"minWatchInterval"`
+
+	// The directory in which recordings of the namespace are kept.
+	RecordingsDir string `json:"recordingsDir"`
+
+	// In single-port mode, the static files and the API are both served from
+	// WebServerAddress, with the API under API_PATH.
+	SinglePort bool `json:"singlePort"`
+
+	// The API and WebSocket URLs given to the JS app. If empty, they are
+	// derived from the addresses above. Useful when browserd runs behind a
+	// proxy.
+	APIURL       string `json:"apiURL"`
+	WebSocketURL string `json:"webSocketURL"`
+
+	// The origins of the web pages, besides the app's, that may use the API,
+	// e.g. "https://tools.example.com". "*" allows every origin. See
+	// authorize.
+	AllowedOrigins stringList `json:"allowedOrigins"`
+
+	// The hosts, as host:port, that the servers are reached as besides their
+	// addresses, e.g. behind a proxy or when listening on all interfaces.
+	// Requests to other hosts are refused. The app may be served from them.
+	AllowedHosts stringList `json:"allowedHosts"`
+
+	// In read-only mode, requests that change the namespace, permissions or
+	// credentials are refused, and so are RPCs, unless AllowedTags is set.
+	// If it is, RPCs are only made to methods with one of these tags, e.g.
+	// "access.Read". See checkPolicy.
+	ReadOnly    bool       `json:"readOnly"`
+	AllowedTags stringList `json:"allowedTags"`
+
+	// If TLSCert and TLSKey name a certificate and key, or TLSSelfSigned is
+	// set, both servers are served over HTTPS. The files are reloaded when
+	// they change. If RedirectAddress is set, HTTP requests to it are
+	// redirected to the web server over HTTPS.
+	TLSCert         string `json:"tlsCert"`
+	TLSKey          string `json:"tlsKey"`
+	TLSSelfSigned   bool   `json:"tlsSelfSigned"`
+	RedirectAddress string `json:"httpRedirectAddress"`
+
+	// The secret that every API request must present. If empty, a random
+	// one is made for each launch.
+	APIToken string `json:"apiToken"`
+
+	// token is the secret of this launch.
+	token string
+}
+
+var (
+	configFile string
+	cfg        = &config{
+		ServerAddress:    "localhost:9002",
+		WebServerAddress: "localhost:9001",
+		HTMLDir:          "public",
+		RecordingsDir:    "recordings",
+		CacheTTL:         duration(30 * time.Second),
+		MaxRootSets:      16,
+		Profiles:         stringMap{},
+		WatchInterval:    duration(10 * time.Second),
+		MinWatchInterval: duration(time.Second),
+		RPCTimeout:       duration(15 * time.Second),
+		Timeouts:         durationMap{},
+		MinTimeout:       duration(time.Second),
+		MaxTimeout:       duration(5 * time.Minute),
+		MaxRetries:       5,
+		RetryBackoff:     duration(250 * time.Millisecond),
+	}
+)
+
+func init() {
+	flag.StringVar(&configFile, "config", "", "path to a JSON config file; flags set on the command line take precedence over it")
+	flag.StringVar(&cfg.ServerAddress, "addr", cfg.ServerAddress, "address of the API server")
+	flag.StringVar(&cfg.WebServerAddress, "web-addr", cfg.WebServerAddress, "address of the web server for the static files")
+	flag.StringVar(&cfg.HTMLDir, "html-dir", cfg.HTMLDir, "directory of the static files")
+	flag.Var(&cfg.CacheTTL, "cache-ttl", "how long the results of globs, resolves and signatures are cached; 0 disables the cache")
+	flag.IntVar(&cfg.MaxRootSets, "max-root-sets", cfg.MaxRootSets, "maximum number of sets of namespace roots, besides the default one, that are kept for requests")
+	flag.Var(&cfg.Profiles, "profiles", "credentials directories that requests may act as, by profile name, e.g. me=/home/me/.v23,service=/etc/service/creds")
+	flag.Var(&cfg.WatchInterval, "watch-interval", "default interval at which watches glob the namespace")
+	flag.Var(&cfg.MinWatchInterval, "min-watch-interval", "shortest interval at which watches may glob the namespace")
+	flag.StringVar(&cfg.RecordingsDir, "recordings-dir", cfg.RecordingsDir, "directory in which recordings of the namespace are kept")
+	flag.Var(&cfg.RPCTimeout, "rpc-timeout", "default timeout for each namespace operation and RPC")
+	flag.Var(&cfg.Timeouts, "timeouts", "timeouts for some request types, overriding -rpc-timeout, e.g. glob=1m,makeRPC=30s")
+	flag.Var(&cfg.MinTimeout, "min-timeout", "lower bound of the timeouts that requests may ask for")
+	flag.Var(&cfg.MaxTimeout, "max-timeout", "upper bound of the timeouts that requests may ask for")
+	flag.IntVar(&cfg.MaxRetries, "max-retries", cfg.MaxRetries, "maximum number of retries that a request may ask for")
+	flag.Var(&cfg.RetryBackoff, "retry-backoff", "wait before the first retry of a request; doubled for each further retry")
+	flag.BoolVar(&cfg.SinglePort, "single-port", cfg.SinglePort, "if true, serves the static files at / and the API at "+API_PATH+" on -web-addr")
+	flag.StringVar(&cfg.APIURL, "api-url", cfg.APIURL, "API URL given to the JS app; derived from the addresses if empty")
+	flag.BoolVar(&cfg.ReadOnly, "read-only", cfg.ReadOnly, "if true, refuses requests that change the namespace, permissions or credentials, and RPCs unless -allowed-tags is set")
+	flag.Var(&cfg.AllowedTags, "allowed-tags", "if set, RPCs are only made to methods with one of these tags, e.g. access.Read,access.Resolve")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "PEM certificate file; if set, both servers are served over HTTPS, and the file is reloaded when it changes")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "PEM key file of -tls-cert")
+	flag.BoolVar(&cfg.TLSSelfSigned, "tls-self-signed", cfg.TLSSelfSigned, "if true and -tls-cert is not set, both servers are served over HTTPS with a self-signed certificate made at startup")
+	flag.StringVar(&cfg.RedirectAddress, "http-redirect-addr", cfg.RedirectAddress, "address of an HTTP server that redirects to the web server over HTTPS")
+	flag.Var(&cfg.AllowedOrigins, "allowed-origins", "origins of web pages, besides the app's, that may use the API, e.g. https://tools.example.com; * allows every origin")
+	flag.Var(&cfg.AllowedHosts, "allowed-hosts", "hosts, as host:port, that the servers are also reached as, e.g. behind a proxy; requests to other hosts are refused")
+	flag.StringVar(&cfg.APIToken, "api-token", cfg.APIToken, "secret that every API request must present; a random one is made for each launch if empty")
+	flag.StringVar(&cfg.WebSocketURL, "ws-url", cfg.WebSocketURL, "WebSocket URL given to the JS app; derived from the addresses if empty")
+}
+
+// load reads the JSON config file at path into c. The values of flags set on
+// the command line are restored afterwards, so they win over the file.
+func (c *config) load(path string) error {
+	explicit := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+
+	for name, value := range explicit {
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiURL returns the URL at which the JS app should reach the API.
+func (c *config) apiURL() string {
+	switch {
+	case c.APIURL != "":
+		return c.APIURL
+	case c.SinglePort:
+		return API_PATH
+	case c.useTLS():
+		return "https://" + c.ServerAddress
+	default:
+		return "http://" + c.ServerAddress
+	}
+}
+
+// webSocketURL returns the URL at which the JS app should open its WebSocket.
+// A URL without a host is relative to the page.
+func (c *config) webSocketURL() string {
+	switch {
+	case c.WebSocketURL != "":
+		return c.WebSocketURL
+	case c.SinglePort:
+		return WS_PATH
+	case c.useTLS():
+		return "wss://" + c.ServerAddress + WS_PATH
+	default:
+		return "ws://" + c.ServerAddress + WS_PATH
+	}
+}
+
+// clientConfig is served to the JS app at CLIENT_CONFIG_PATH. It holds the
+// API token, so it is served without CORS headers: pages of other origins
+// cannot read it. Neither can pages that rebind their DNS name to the
+// daemon's address, since requests to other hosts are refused.
+type clientConfig struct {
+	APIURL       string `json:"apiURL"`
+	WebSocketURL string `json:"webSocketURL"`
+	Token        string `json:"token"`
+}
+
+func (c *config) serveClientConfig(rw http.ResponseWriter, req *http.Request) {
+	if !c.hostAllowed(req.Host) {
+		http.Error(rw, "host "+req.Host+" is not allowed", http.StatusForbidden)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(rw).Encode(clientConfig{
+		APIURL:       c.apiURL(),
+		WebSocketURL: c.webSocketURL(),
+		Token:        c.token,
+	})
+}
+
+// duration is a time.Duration that is written as a string like "15s", both
+// on the command line and in the config file.
+type duration time.Duration
+
+func (d *duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"15s\": %v", err)
+	}
+	return d.Set(s)
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
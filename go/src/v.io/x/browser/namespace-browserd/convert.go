@@ -0,0 +1,406 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+/*
+ * Converts the JSON arguments given by the browser to *vdl.Value, using the
+ * types from the method signature. JSON numbers are decoded with UseNumber so
+ * that 64-bit integers keep their precision.
+ *
+ * The JSON form of each VDL kind is:
+ *   bool: true or false
+ *   byte, uint*, int*, float*: a number, or a string holding one
+ *   string: a string
+ *   enum: the label as a string
+ *   []byte and [N]byte: a base64 string, or an array of numbers
+ *   array, list: an array
+ *   set: an array of keys
+ *   map: an object; non-string keys are written as strings
+ *   struct: an object with some of the field names; the others are zero
+ *   union: an object with exactly one field name
+ *   optional: null, or the value of the element type
+ *   any: null, a bool, number, string, array or object
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/rpc"
+	"v.io/v23/vdl"
+	"v.io/v23/vdlroot/signature"
+	"v.io/v23/verror"
+)
+
+// serverSignature returns the signature(s) of the server at name, from the
+// cache if it has them.
+func (b *NamespaceBrowser) serverSignature(ctx *context.T, name string) ([]signature.Interface, error) {
+	scope := cacheScope(ctx)
+	if sig, ok := b.cache.get("signature", scope, name); ok {
+		return sig.([]signature.Interface), nil
+	}
+	var sig []signature.Interface
+	if err := v23.GetClient(ctx).Call(ctx, name, rpc.ReservedSignature, nil, []interface{}{&sig}); err != nil {
+		return nil, err
+	}
+	b.cache.put("signature", scope, name, name, sig, nil)
+	return sig, nil
+}
+
+// methodSignature returns the signature of a method of the server at name.
+func (b *NamespaceBrowser) methodSignature(ctx *context.T, name, method string) (signature.Method, error) {
+	sig, err := b.serverSignature(ctx, name)
+	if err != nil {
+		return signature.Method{}, err
+	}
+	m, ok := signature.FirstMethod(sig, method)
+	if !ok {
+		return signature.Method{}, verror.New(verror.ErrBadArg, ctx, fmt.Sprintf("%s has no method %q", name, method))
+	}
+	return m, nil
+}
+
+// typedInArgs returns the signature of the method called with params, and its
+// args converted to the types of the method's in-args.
+func (b *NamespaceBrowser) typedInArgs(ctx *context.T, params rpcParams) (signature.Method, []interface{}, error) {
+	method, err := b.methodSignature(ctx, params.Name, params.MethodName)
+	if err != nil {
+		return signature.Method{}, nil, err
+	}
+	inargs, err := convertInArgs(method, params.Args)
+	if err != nil {
+		return signature.Method{}, nil, verror.New(verror.ErrBadArg, ctx, err.Error())
+	}
+	return method, inargs, nil
+}
+
+// makeOutArgs returns the *vdl.Value out-args for a call to method, and the
+// pointers to them to pass to the call.
+func makeOutArgs(method signature.Method) ([]*vdl.Value, []interface{}) {
+	outargs := make([]*vdl.Value, len(method.OutArgs))
+	outptrs := make([]interface{}, len(method.OutArgs))
+	for i := range outargs {
+		outptrs[i] = &outargs[i]
+	}
+	return outargs, outptrs
+}
+
+// decodeJSON decodes raw, keeping numbers as json.Number.
+func decodeJSON(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// convertInArgs converts the JSON arguments of a call to the in-args of
+// method.
+func convertInArgs(method signature.Method, args []json.RawMessage) ([]interface{}, error) {
+	if len(args) != len(method.InArgs) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", method.Name, len(method.InArgs), len(args))
+	}
+	ret := make([]interface{}, len(args))
+	for i, raw := range args {
+		arg := method.InArgs[i]
+		path := fmt.Sprintf("args[%d]", i)
+		if arg.Name != "" {
+			path = fmt.Sprintf("args[%d] (%s)", i, arg.Name)
+		}
+		x, err := decodeJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		v, err := jsonToValue(arg.Type, x, path)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = v
+	}
+	return ret, nil
+}
+
+// jsonToValue converts x, decoded by decodeJSON, to a value of type t. The
+// path names x in errors.
+func jsonToValue(t *vdl.Type, x interface{}, path string) (*vdl.Value, error) {
+	switch t.Kind() {
+	case vdl.Any:
+		if x == nil {
+			return vdl.ZeroValue(t), nil
+		}
+		return vdl.ValueOf(jsonToNative(x)), nil
+	case vdl.Optional:
+		if x == nil {
+			return vdl.ZeroValue(t), nil
+		}
+		elem, err := jsonToValue(t.Elem(), x, path)
+		if err != nil {
+			return nil, err
+		}
+		return vdl.OptionalValue(elem), nil
+	}
+
+	v := vdl.ZeroValue(t)
+	switch t.Kind() {
+	case vdl.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		v.AssignBool(b)
+	case vdl.Byte, vdl.Uint16, vdl.Uint32, vdl.Uint64:
+		s, ok := numberString(x)
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		u, err := strconv.ParseUint(s, 10, bitSize(t.Kind()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s is not a valid %v", path, s, t)
+		}
+		v.AssignUint(u)
+	case vdl.Int8, vdl.Int16, vdl.Int32, vdl.Int64:
+		s, ok := numberString(x)
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		i, err := strconv.ParseInt(s, 10, bitSize(t.Kind()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s is not a valid %v", path, s, t)
+		}
+		v.AssignInt(i)
+	case vdl.Float32, vdl.Float64:
+		s, ok := numberString(x)
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		f, err := strconv.ParseFloat(s, bitSize(t.Kind()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s is not a valid %v", path, s, t)
+		}
+		v.AssignFloat(f)
+	case vdl.String:
+		s, ok := x.(string)
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		v.AssignString(s)
+	case vdl.Enum:
+		label, ok := x.(string)
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		index := t.EnumIndex(label)
+		if index < 0 {
+			labels := make([]string, t.NumEnumLabel())
+			for i := range labels {
+				labels[i] = t.EnumLabel(i)
+			}
+			return nil, fmt.Errorf("%s: %q is not a label of %v; expected one of %v", path, label, t, labels)
+		}
+		v.AssignEnumIndex(index)
+	case vdl.Array, vdl.List:
+		if s, ok := x.(string); ok && t.Elem().Kind() == vdl.Byte {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bytes must be base64: %v", path, err)
+			}
+			x = bytesToJSON(b)
+		}
+		list, ok := x.([]interface{})
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		if t.Kind() == vdl.Array {
+			if len(list) != t.Len() {
+				return nil, fmt.Errorf("%s: %v needs %d elements, got %d", path, t, t.Len(), len(list))
+			}
+		} else {
+			v.AssignLen(len(list))
+		}
+		for i, ex := range list {
+			elem, err := jsonToValue(t.Elem(), ex, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			v.Index(i).Assign(elem)
+		}
+	case vdl.Set:
+		list, ok := x.([]interface{})
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		for i, kx := range list {
+			key, err := jsonToValue(t.Key(), kx, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			v.AssignSetKey(key)
+		}
+	case vdl.Map:
+		obj, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		for _, k := range sortedKeys(obj) {
+			keyPath := fmt.Sprintf("%s[%q]", path, k)
+			key, err := jsonToValue(t.Key(), mapKeyToJSON(t.Key(), k), keyPath)
+			if err != nil {
+				return nil, err
+			}
+			elem, err := jsonToValue(t.Elem(), obj[k], keyPath)
+			if err != nil {
+				return nil, err
+			}
+			v.AssignMapIndex(key, elem)
+		}
+	case vdl.Struct:
+		obj, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, typeError(t, x, path)
+		}
+		for _, name := range sortedKeys(obj) {
+			field, index := t.FieldByName(name)
+			if index < 0 {
+				return nil, fmt.Errorf("%s: %v has no field %q", path, t, name)
+			}
+			fv, err := jsonToValue(field.Type, obj[name], path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			v.StructField(index).Assign(fv)
+		}
+	case vdl.Union:
+		obj, ok := x.(map[string]interface{})
+		if !ok || len(obj) != 1 {
+			return nil, fmt.Errorf("%s: %v must be an object with exactly one field", path, t)
+		}
+		for name, fx := range obj {
+			field, index := t.FieldByName(name)
+			if index < 0 {
+				return nil, fmt.Errorf("%s: %v has no field %q", path, t, name)
+			}
+			fv, err := jsonToValue(field.Type, fx, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			v.AssignUnionField(index, fv)
+		}
+	default:
+		return nil, fmt.Errorf("%s: values of type %v cannot be given in JSON", path, t)
+	}
+	return v, nil
+}
+
+// jsonToNative converts x, decoded by decodeJSON, to a Go value for an any
+// type. Numbers become int64 if they are integers and float64 otherwise.
+func jsonToNative(x interface{}) interface{} {
+	switch x := x.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case []interface{}:
+		ret := make([]interface{}, len(x))
+		for i, ex := range x {
+			ret[i] = jsonToNative(ex)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(x))
+		for k, ex := range x {
+			ret[k] = jsonToNative(ex)
+		}
+		return ret
+	}
+	return x
+}
+
+// numberString returns the digits of a JSON number. Strings are accepted as
+// well, since JS numbers cannot hold every 64-bit integer.
+func numberString(x interface{}) (string, bool) {
+	switch x := x.(type) {
+	case json.Number:
+		return x.String(), true
+	case string:
+		return x, true
+	}
+	return "", false
+}
+
+// mapKeyToJSON returns the JSON form of a map key of type t, which JSON
+// objects always hold as a string.
+func mapKeyToJSON(t *vdl.Type, k string) interface{} {
+	switch t.Kind() {
+	case vdl.Bool:
+		if b, err := strconv.ParseBool(k); err == nil {
+			return b
+		}
+	case vdl.Byte, vdl.Uint16, vdl.Uint32, vdl.Uint64, vdl.Int8, vdl.Int16, vdl.Int32, vdl.Int64, vdl.Float32, vdl.Float64:
+		return json.Number(k)
+	}
+	return k
+}
+
+func bytesToJSON(b []byte) []interface{} {
+	ret := make([]interface{}, len(b))
+	for i, c := range b {
+		ret[i] = json.Number(strconv.Itoa(int(c)))
+	}
+	return ret
+}
+
+func bitSize(k vdl.Kind) int {
+	switch k {
+	case vdl.Byte, vdl.Int8:
+		return 8
+	case vdl.Uint16, vdl.Int16:
+		return 16
+	case vdl.Uint32, vdl.Int32, vdl.Float32:
+		return 32
+	}
+	return 64
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func typeError(t *vdl.Type, x interface{}, path string) error {
+	return fmt.Errorf("%s: expected %v, got %s", path, t, jsonKind(x))
+}
+
+// jsonKind describes the JSON value x for errors.
+func jsonKind(x interface{}) string {
+	switch x := x.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprintf("boolean %v", x)
+	case json.Number:
+		return fmt.Sprintf("number %v", x)
+	case string:
+		return fmt.Sprintf("string %q", x)
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", x)
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"v.io/v23/vdl"
+	"v.io/v23/vdlroot/signature"
+)
+
+// Types and values shared by the tests of convert.go and value.go.
+var (
+	pointType = vdl.NamedType("test.Point", vdl.StructType(
+		vdl.Field{Name: "X", Type: vdl.Int32Type},
+		vdl.Field{Name: "Y", Type: vdl.Int32Type},
+	))
+	colorType = vdl.NamedType("test.Color", vdl.EnumType("Red", "Green"))
+	shapeType = vdl.NamedType("test.Shape", vdl.UnionType(
+		vdl.Field{Name: "Radius", Type: vdl.Float64Type},
+		vdl.Field{Name: "Name", Type: vdl.StringType},
+	))
+)
+
+func pointValue(x, y int64) *vdl.Value {
+	v := vdl.ZeroValue(pointType)
+	v.StructField(0).AssignInt(x)
+	v.StructField(1).AssignInt(y)
+	return v
+}
+
+func colorValue(label string) *vdl.Value {
+	return vdl.ZeroValue(colorType).AssignEnumLabel(label)
+}
+
+func shapeValue(index int, field *vdl.Value) *vdl.Value {
+	return vdl.ZeroValue(shapeType).AssignUnionField(index, field)
+}
+
+func mustDecodeJSON(t *testing.T, raw string) interface{} {
+	x, err := decodeJSON([]byte(raw))
+	if err != nil {
+		t.Fatalf("decodeJSON(%s) failed: %v", raw, err)
+	}
+	return x
+}
+
+func TestJSONToValue(t *testing.T) {
+	tests := []struct {
+		t    *vdl.Type
+		json string
+		want *vdl.Value
+	}{
+		{vdl.BoolType, `true`, vdl.ValueOf(true)},
+		{vdl.StringType, `"a"`, vdl.ValueOf("a")},
+		{vdl.ByteType, `255`, vdl.ValueOf(byte(255))},
+		{vdl.Uint32Type, `7`, vdl.ValueOf(uint32(7))},
+		{vdl.Uint32Type, `4294967295`, vdl.ValueOf(uint32(4294967295))},
+		// JS numbers cannot hold every 64-bit integer, so they may be strings.
+		{vdl.Uint32Type, `"7"`, vdl.ValueOf(uint32(7))},
+		{vdl.Uint64Type, `"18446744073709551615"`, vdl.ValueOf(uint64(18446744073709551615))},
+		{vdl.Uint64Type, `18446744073709551615`, vdl.ValueOf(uint64(18446744073709551615))},
+		{vdl.Int64Type, `"-9223372036854775808"`, vdl.ValueOf(int64(-9223372036854775808))},
+		{vdl.Int32Type, `-5`, vdl.ValueOf(int32(-5))},
+		{vdl.Float64Type, `1.5`, vdl.ValueOf(1.5)},
+		{vdl.Float64Type, `"+Inf"`, vdl.ValueOf(math.Inf(1))},
+		{vdl.Float32Type, `2`, vdl.ValueOf(float32(2))},
+		// Bytes are base64, or an array of numbers.
+		{vdl.ListType(vdl.ByteType), `"aGk="`, vdl.ValueOf([]byte("hi"))},
+		{vdl.ListType(vdl.ByteType), `[104, 105]`, vdl.ValueOf([]byte("hi"))},
+		{vdl.ListType(vdl.ByteType), `""`, vdl.ValueOf([]byte{})},
+		{vdl.ArrayType(2, vdl.ByteType), `"aGk="`, vdl.ValueOf([2]byte{'h', 'i'})},
+		{vdl.ListType(vdl.Uint32Type), `[1, 2]`, vdl.ValueOf([]uint32{1, 2})},
+		{vdl.ListType(vdl.Uint32Type), `[]`, vdl.ValueOf([]uint32{})},
+		{vdl.ArrayType(2, vdl.Int32Type), `[1, 2]`, vdl.ValueOf([2]int32{1, 2})},
+		{vdl.SetType(vdl.StringType), `["a", "b"]`, vdl.ValueOf(map[string]struct{}{"a": {}, "b": {}})},
+		{vdl.MapType(vdl.StringType, vdl.Uint64Type), `{"a": 1}`, vdl.ValueOf(map[string]uint64{"a": 1})},
+		// Keys of other kinds are strings in JSON objects.
+		{vdl.MapType(vdl.Uint32Type, vdl.StringType), `{"1": "a"}`, vdl.ValueOf(map[uint32]string{1: "a"})},
+		{vdl.MapType(vdl.BoolType, vdl.StringType), `{"true": "a"}`, vdl.ValueOf(map[bool]string{true: "a"})},
+		{pointType, `{"X": 1, "Y": 2}`, pointValue(1, 2)},
+		{pointType, `{"Y": 2}`, pointValue(0, 2)},
+		{pointType, `{}`, pointValue(0, 0)},
+		{colorType, `"Green"`, colorValue("Green")},
+		{shapeType, `{"Name": "square"}`, shapeValue(1, vdl.ValueOf("square"))},
+		{shapeType, `{"Radius": 2.5}`, shapeValue(0, vdl.ValueOf(2.5))},
+		{vdl.OptionalType(pointType), `null`, vdl.ZeroValue(vdl.OptionalType(pointType))},
+		{vdl.OptionalType(pointType), `{"X": 1}`, vdl.OptionalValue(pointValue(1, 0))},
+		{vdl.AnyType, `null`, vdl.ZeroValue(vdl.AnyType)},
+		{vdl.AnyType, `3`, vdl.ValueOf(int64(3))},
+		{vdl.AnyType, `3.5`, vdl.ValueOf(3.5)},
+		{vdl.AnyType, `"a"`, vdl.ValueOf("a")},
+	}
+	for _, test := range tests {
+		got, err := jsonToValue(test.t, mustDecodeJSON(t, test.json), "arg")
+		if err != nil {
+			t.Errorf("jsonToValue(%v, %s) failed: %v", test.t, test.json, err)
+			continue
+		}
+		if !vdl.EqualValue(got, test.want) {
+			t.Errorf("jsonToValue(%v, %s): got %v, want %v", test.t, test.json, got, test.want)
+		}
+	}
+
+	// NaN is not equal to itself, so it is only checked to be NaN.
+	if got, err := jsonToValue(vdl.Float64Type, mustDecodeJSON(t, `"NaN"`), "arg"); err != nil || !math.IsNaN(got.Float()) {
+		t.Errorf(`jsonToValue(float64, "NaN"): got %v, %v, want NaN`, got, err)
+	}
+}
+
+func TestJSONToValueErrors(t *testing.T) {
+	tests := []struct {
+		t         *vdl.Type
+		json      string
+		path, err string // The error starts with the path of the bad value.
+	}{
+		{vdl.BoolType, `"true"`, "arg", `expected bool, got string "true"`},
+		{vdl.StringType, `1`, "arg", `expected string, got number 1`},
+		{vdl.Uint32Type, `4294967296`, "arg", `4294967296 is not a valid uint32`},
+		{vdl.Uint32Type, `-1`, "arg", `-1 is not a valid uint32`},
+		{vdl.Uint32Type, `1.5`, "arg", `1.5 is not a valid uint32`},
+		{vdl.Uint32Type, `"seven"`, "arg", `seven is not a valid uint32`},
+		{vdl.Uint32Type, `null`, "arg", `expected uint32, got null`},
+		{vdl.ByteType, `256`, "arg", `256 is not a valid byte`},
+		{vdl.Uint64Type, `"18446744073709551616"`, "arg", `18446744073709551616 is not a valid uint64`},
+		{vdl.Int32Type, `true`, "arg", `expected int32, got boolean true`},
+		{vdl.ListType(vdl.ByteType), `"not base64!"`, "arg", `bytes must be base64`},
+		{vdl.ListType(vdl.ByteType), `[1, 256]`, "arg[1]", `256 is not a valid byte`},
+		{vdl.ListType(vdl.Uint32Type), `{}`, "arg", `expected []uint32, got object`},
+		{vdl.ListType(vdl.Uint32Type), `[1, "x"]`, "arg[1]", `x is not a valid uint32`},
+		{vdl.ArrayType(2, vdl.Int32Type), `[1]`, "arg", `needs 2 elements, got 1`},
+		{vdl.MapType(vdl.Uint32Type, vdl.StringType), `{"x": "a"}`, `arg["x"]`, `x is not a valid uint32`},
+		{vdl.MapType(vdl.StringType, vdl.Uint32Type), `{"a": "b"}`, `arg["a"]`, `b is not a valid uint32`},
+		{pointType, `[]`, "arg", `got array`},
+		{pointType, `{"Z": 1}`, "arg", `has no field "Z"`},
+		{pointType, `{"X": 1, "Y": "two"}`, "arg.Y", `two is not a valid int32`},
+		{colorType, `"Blue"`, "arg", `expected one of [Red Green]`},
+		{colorType, `0`, "arg", `got number 0`},
+		{shapeType, `{}`, "arg", `must be an object with exactly one field`},
+		{shapeType, `{"Radius": 1, "Name": "a"}`, "arg", `must be an object with exactly one field`},
+		{shapeType, `{"Side": 1}`, "arg", `has no field "Side"`},
+		{shapeType, `{"Name": 1}`, "arg.Name", `expected string, got number 1`},
+		{vdl.OptionalType(pointType), `{"X": "a"}`, "arg.X", `a is not a valid int32`},
+		{vdl.TypeObjectType, `"uint32"`, "arg", `cannot be given in JSON`},
+	}
+	for _, test := range tests {
+		_, err := jsonToValue(test.t, mustDecodeJSON(t, test.json), "arg")
+		if err == nil || !strings.HasPrefix(err.Error(), test.path+": ") || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("jsonToValue(%v, %s): got error %v, want %s: ...%s", test.t, test.json, err, test.path, test.err)
+		}
+	}
+}
+
+func TestConvertInArgs(t *testing.T) {
+	method := signature.Method{
+		Name: "Set",
+		InArgs: []signature.Arg{
+			{Name: "count", Type: vdl.Uint32Type},
+			{Type: pointType},
+		},
+	}
+	args := func(raw ...string) []json.RawMessage {
+		var ret []json.RawMessage
+		for _, r := range raw {
+			ret = append(ret, json.RawMessage(r))
+		}
+		return ret
+	}
+
+	got, err := convertInArgs(method, args(`"7"`, `{"X": 1}`))
+	if err != nil {
+		t.Fatalf("convertInArgs failed: %v", err)
+	}
+	if len(got) != 2 || !vdl.EqualValue(got[0].(*vdl.Value), vdl.ValueOf(uint32(7))) || !vdl.EqualValue(got[1].(*vdl.Value), pointValue(1, 0)) {
+		t.Errorf("convertInArgs: got %v", got)
+	}
+
+	tests := []struct {
+		args []json.RawMessage
+		err  string
+	}{
+		{args(`1`), `Set takes 2 arguments, got 1`},
+		{args(`1`, `{}`, `2`), `Set takes 2 arguments, got 3`},
+		{args(`-1`, `{}`), `args[0] (count): -1 is not a valid uint32`},
+		{args(`1`, `{"X": true}`), `args[1].X: expected int32, got boolean true`},
+		{args(`{`, `{}`), `args[0] (count): `},
+	}
+	for _, test := range tests {
+		_, err := convertInArgs(method, test.args)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("convertInArgs(%s): got error %v, want %q", test.args, err, test.err)
+		}
+	}
+}
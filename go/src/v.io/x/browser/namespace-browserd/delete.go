@@ -0,0 +1,198 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+)
+
+// How long the token of a deleteTree dry run can be used to delete the names
+// it listed.
+const deleteTokenTTL = 2 * time.Minute
+
+// deleteTreeParams are the params of deleteTree.
+type deleteTreeParams struct {
+	Name   string `json:"name"`
+	DryRun bool   `json:"dryRun"`
+	Token  string `json:"token"` // The token of a dry run; required otherwise.
+}
+
+// deleteToken is issued by a dry run of deleteTree, and allows the names it
+// listed to be deleted for a short time, with the same profile and roots
+// (see cacheScope), since the same names may be other mount points elsewhere.
+type deleteToken struct {
+	scope   string
+	name    string
+	names   []string
+	expires time.Time
+}
+
+// tokenError is returned for a deleteTree request whose token is unknown,
+// expired, or was issued for another name or scope.
+type tokenError struct {
+	error
+}
+
+// deleteTokens holds the tokens that have not been used yet.
+type deleteTokens struct {
+	mu     sync.Mutex
+	tokens map[string]deleteToken // GUARDED_BY(mu)
+}
+
+func newDeleteTokens() *deleteTokens {
+	return &deleteTokens{tokens: map[string]deleteToken{}}
+}
+
+func (d *deleteTokens) add(scope, name string, names []string) (string, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for id, token := range d.tokens {
+		if now.After(token.expires) {
+			delete(d.tokens, id)
+		}
+	}
+	d.tokens[id] = deleteToken{scope: scope, name: name, names: names, expires: now.Add(deleteTokenTTL)}
+	return id, nil
+}
+
+// take returns the names to delete for a token issued for name in scope. The
+// token can only be used once.
+func (d *deleteTokens) take(id, scope, name string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	token, ok := d.tokens[id]
+	if !ok || token.name != name {
+		return nil, tokenError{fmt.Errorf("no confirmation token %q for %q; make a dry run first", id, name)}
+	}
+	if token.scope != scope {
+		return nil, tokenError{fmt.Errorf("the confirmation token for %q was issued for another profile or roots; make a dry run with these", name)}
+	}
+	delete(d.tokens, id)
+	if time.Now().After(token.expires) {
+		return nil, tokenError{fmt.Errorf("the confirmation token for %q has expired; make a new dry run", name)}
+	}
+	return token.names, nil
+}
+
+/* deleteTree deletes a name and everything under it, and passes its responses
+ * to send. A dry run deletes nothing, but lists the names that would be
+ * deleted and issues a confirmation token:
+ *
+ * { name: <string> } for each name that would be deleted,
+ * { name: <string>, err: <err> } for each name that could not be listed,
+ * { token: <string>, deleteEnd: true } once the whole tree has been listed.
+ *
+ * The names are then deleted, within deleteTokenTTL, by a request with the
+ * token. The names under a name are deleted before it:
+ *
+ * { name: <string>, deleted: true } for each name deleted,
+ * { name: <string>, err: <err> } for each name that could not be deleted,
+ * { deleteEnd: true } once all have been tried.
+ *
+ * The token is only valid with the profile and roots of the dry run. Only
+ * the names listed by the dry run are deleted. A name that gained children
+ * since then is not deleted, and neither are its parents.
+ *
+ * If the request fails as a whole, err is set in the last response, and the
+ * error is returned too.
+ */
+func (b *NamespaceBrowser) deleteTree(ctx *context.T, params string, opts requestOptions, send func(deleteTreeReturn)) error {
+	// fail ends the request with an error.
+	fail := func(err error, format string) error {
+		send(deleteTreeReturn{DeleteEnd: true, Err: fmt.Sprintf(format, err)})
+		return err
+	}
+	var data deleteTreeParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return fail(badParamsError{err}, "bad params: %v")
+	}
+	if data.Name == "" {
+		return fail(badParamsError{fmt.Errorf("name is required")}, "bad params: %v")
+	}
+	if err := b.checkPolicy("deleteTree", params); err != nil {
+		return fail(err, "%v")
+	}
+
+	if data.DryRun {
+		fmt.Printf("Delete tree (dry run): %s\n", data.Name)
+		var globCh <-chan naming.GlobReply
+		err := b.withRetries(ctx, opts, func() (err error) {
+			globCh, err = v23.GetNamespace(ctx).Glob(ctx, naming.Join(data.Name, "..."))
+			return err
+		})
+		if err != nil {
+			return fail(err, "%v")
+		}
+		var names []string
+		for entry := range globCh {
+			switch v := entry.(type) {
+			case *naming.GlobReplyEntry:
+				names = append(names, v.Value.Name)
+				send(deleteTreeReturn{Name: v.Value.Name})
+			case *naming.GlobReplyError:
+				send(deleteTreeReturn{Name: v.Value.Name, Err: fmt.Sprintf("%v", v.Value.Error)})
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return fail(err, "the tree could not be listed: %v")
+		}
+		if b.config.ReadOnly {
+			// The token could not be used.
+			send(deleteTreeReturn{DeleteEnd: true})
+			return nil
+		}
+		token, err := b.deleteTokens.add(cacheScope(ctx), data.Name, names)
+		if err != nil {
+			return fail(err, "%v")
+		}
+		send(deleteTreeReturn{Token: token, DeleteEnd: true})
+		return nil
+	}
+
+	names, err := b.deleteTokens.take(data.Token, cacheScope(ctx), data.Name)
+	if err != nil {
+		return fail(err, "%v")
+	}
+	fmt.Printf("Delete tree: %s (%d names)\n", data.Name, len(names))
+
+	// Longer names first, so that children are deleted before their parents.
+	sort.Sort(sort.Reverse(byLength(names)))
+	defer b.cache.invalidate(data.Name)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := v23.GetNamespace(ctx).Delete(ctx, name, false); err != nil {
+			send(deleteTreeReturn{Name: name, Err: fmt.Sprintf("%v", err)})
+			continue
+		}
+		send(deleteTreeReturn{Name: name, Deleted: true})
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err, "%v")
+	}
+	send(deleteTreeReturn{DeleteEnd: true})
+	return nil
+}
+
+type byLength []string
+
+func (s byLength) Len() int           { return len(s) }
+func (s byLength) Less(i, j int) bool { return len(s[i]) < len(s[j]) }
+func (s byLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,241 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotDiff lists how a subtree changed between two snapshots.
+type snapshotDiff struct {
+	Name      string        `json:"name"`
+	FromTaken time.Time     `json:"fromTaken"`
+	ToTaken   time.Time     `json:"toTaken"`
+	Added     []string      `json:"added"`   // Names only in the newer snapshot.
+	Removed   []string      `json:"removed"` // Names only in the older snapshot.
+	Changed   []entryChange `json:"changed"`
+
+	// Names in only one of the snapshots, under a name that the other could
+	// not glob. Whether they were added or removed is unknown.
+	Unreadable []string `json:"unreadable"`
+}
+
+// entryChange lists how the entry of a name changed. Server deadlines are
+// left out, since they change every time a server refreshes its mount.
+type entryChange struct {
+	Name           string   `json:"name"`
+	AddedServers   []string `json:"addedServers,omitempty"`
+	RemovedServers []string `json:"removedServers,omitempty"`
+	Flags          []string `json:"flags,omitempty"` // e.g. "isLeaf: false -> true"
+
+	// Only compared if both snapshots recorded them, and could read them.
+	Permissions []permissionsChange `json:"permissions,omitempty"`
+	Signature   []signatureChange   `json:"signature,omitempty"`
+
+	// What was recorded but could not be read, and so was not compared, e.g.
+	// "permissions unreadable in the newer snapshot: <err>".
+	Unreadable []string `json:"unreadable,omitempty"`
+}
+
+// signatureChange is a method that was added to, removed from or changed in
+// the signature of a server.
+type signatureChange struct {
+	Method string `json:"method"` // As <interface>.<method>.
+	Change string `json:"change"` // "added", "removed" or "changed".
+}
+
+// diffSnapshots returns the changes from the snapshot from to the snapshot to.
+func diffSnapshots(from, to *snapshot) *snapshotDiff {
+	diff := &snapshotDiff{
+		Name:      to.Name,
+		FromTaken: from.Taken,
+		ToTaken:   to.Taken,
+		Added:     []string{},
+		Removed:   []string{},
+		Changed:   []entryChange{},
+
+		Unreadable: []string{},
+	}
+	fromFailed, toFailed := failedNames(from), failedNames(to)
+	fromEntries := map[string]snapshotEntry{}
+	for _, e := range from.Entries {
+		fromEntries[e.Name] = e
+	}
+	toEntries := map[string]snapshotEntry{}
+	for _, e := range to.Entries {
+		toEntries[e.Name] = e
+	}
+	for _, e := range from.Entries {
+		if _, ok := toEntries[e.Name]; !ok {
+			if under(e.Name, toFailed) {
+				diff.Unreadable = append(diff.Unreadable, e.Name)
+				continue
+			}
+			diff.Removed = append(diff.Removed, e.Name)
+		}
+	}
+	// The entries are ordered by name, so the changes are too.
+	for _, e := range to.Entries {
+		old, ok := fromEntries[e.Name]
+		if !ok {
+			if under(e.Name, fromFailed) {
+				diff.Unreadable = append(diff.Unreadable, e.Name)
+				continue
+			}
+			diff.Added = append(diff.Added, e.Name)
+			continue
+		}
+		change := entryChange{
+			Name:           e.Name,
+			AddedServers:   stringsMinus(servers(e), servers(old)),
+			RemovedServers: stringsMinus(servers(old), servers(e)),
+		}
+		if old.ServesMountTable != e.ServesMountTable {
+			change.Flags = append(change.Flags, fmt.Sprintf("servesMountTable: %v -> %v", old.ServesMountTable, e.ServesMountTable))
+		}
+		if old.IsLeaf != e.IsLeaf {
+			change.Flags = append(change.Flags, fmt.Sprintf("isLeaf: %v -> %v", old.IsLeaf, e.IsLeaf))
+		}
+		if from.WithPermissions && to.WithPermissions {
+			unreadable := unreadableIn("permissions", old.PermissionsErr, e.PermissionsErr)
+			if len(unreadable) == 0 {
+				change.Permissions = diffPermissions(old.Permissions, e.Permissions)
+			}
+			change.Unreadable = append(change.Unreadable, unreadable...)
+		}
+		if from.WithSignatures && to.WithSignatures {
+			unreadable := unreadableIn("signature", old.SignatureErr, e.SignatureErr)
+			if len(unreadable) == 0 {
+				change.Signature = diffSignatures(old.Signature, e.Signature)
+			}
+			change.Unreadable = append(change.Unreadable, unreadable...)
+		}
+		if len(change.AddedServers)+len(change.RemovedServers)+len(change.Flags)+len(change.Permissions)+len(change.Signature)+len(change.Unreadable) > 0 {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	sort.Strings(diff.Unreadable)
+	return diff
+}
+
+// failedNames returns the names that a snapshot could not glob.
+func failedNames(snap *snapshot) []string {
+	var names []string
+	for _, e := range snap.Errors {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// unreadableIn describes the snapshots in which what could not be read, given
+// the errors recorded in the older and newer one.
+func unreadableIn(what, fromErr, toErr string) []string {
+	var ret []string
+	if fromErr != "" {
+		ret = append(ret, fmt.Sprintf("%s unreadable in the older snapshot: %s", what, fromErr))
+	}
+	if toErr != "" {
+		ret = append(ret, fmt.Sprintf("%s unreadable in the newer snapshot: %s", what, toErr))
+	}
+	return ret
+}
+
+func servers(e snapshotEntry) []string {
+	var ret []string
+	for _, s := range e.Servers {
+		ret = append(ret, s.Server)
+	}
+	return ret
+}
+
+// diffSignatures compares two signatures method by method.
+func diffSignatures(from, to []pInterface) []signatureChange {
+	fromMethods, toMethods := signatureMethods(from), signatureMethods(to)
+	var names []string
+	for name := range fromMethods {
+		names = append(names, name)
+	}
+	for name := range toMethods {
+		names = append(names, name)
+	}
+	var changes []signatureChange
+	for _, name := range stringsMinus(names, nil) { // Sorted, without duplicates.
+		old, inFrom := fromMethods[name]
+		method, inTo := toMethods[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, signatureChange{Method: name, Change: "added"})
+		case !inTo:
+			changes = append(changes, signatureChange{Method: name, Change: "removed"})
+		case old != method:
+			changes = append(changes, signatureChange{Method: name, Change: "changed"})
+		}
+	}
+	return changes
+}
+
+// signatureMethods returns the JSON form of each method of a signature, by
+// <interface>.<method>. The docs are left out, as they do not change the
+// interface.
+func signatureMethods(sig []pInterface) map[string]string {
+	ret := map[string]string{}
+	for _, ifc := range sig {
+		for _, m := range ifc.Methods {
+			m.Doc = ""
+			data, _ := json.Marshal(m)
+			ret[ifc.PkgPath+"."+ifc.Name+"."+m.Name] = string(data)
+		}
+	}
+	return ret
+}
+
+// writeDiffText writes a diff for people to read. Added names are marked with
+// "+", removed ones with "-", unreadable ones with "?", and changed ones with
+// "~", followed by what changed.
+func writeDiffText(w io.Writer, diff *snapshotDiff) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Changes to %s from %s to %s\n", diff.Name, diff.FromTaken.Format(time.RFC3339), diff.ToTaken.Format(time.RFC3339))
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed)+len(diff.Unreadable) == 0 {
+		buf.WriteString("No changes.\n")
+	}
+	for _, name := range diff.Added {
+		fmt.Fprintf(&buf, "+ %s\n", name)
+	}
+	for _, name := range diff.Removed {
+		fmt.Fprintf(&buf, "- %s\n", name)
+	}
+	for _, name := range diff.Unreadable {
+		fmt.Fprintf(&buf, "? %s (could not be globbed in one of the snapshots)\n", name)
+	}
+	for _, c := range diff.Changed {
+		fmt.Fprintf(&buf, "~ %s\n", c.Name)
+		for _, s := range c.AddedServers {
+			fmt.Fprintf(&buf, "    server added: %s\n", s)
+		}
+		for _, s := range c.RemovedServers {
+			fmt.Fprintf(&buf, "    server removed: %s\n", s)
+		}
+		for _, f := range c.Flags {
+			fmt.Fprintf(&buf, "    %s\n", f)
+		}
+		for _, p := range c.Permissions {
+			fmt.Fprintf(&buf, "    permissions: %s %s %s (%s)\n", p.Pattern, p.Change, p.Tag, p.List)
+		}
+		for _, s := range c.Signature {
+			fmt.Fprintf(&buf, "    method %s: %s\n", strings.TrimPrefix(s.Method, "."), s.Change)
+		}
+		for _, u := range c.Unreadable {
+			fmt.Fprintf(&buf, "    %s\n", u)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	server := func(s string) []snapshotServer {
+		return []snapshotServer{{Server: s}}
+	}
+	readAlice := access.Permissions{"Read": {In: []security.BlessingPattern{"dev.v.io:u:alice"}}}
+	readBob := access.Permissions{"Read": {In: []security.BlessingPattern{"dev.v.io:u:bob"}}}
+	sig := func(methods ...string) []pInterface {
+		ifc := pInterface{Name: "Store", PkgPath: "v.io/x/store"}
+		for _, m := range methods {
+			ifc.Methods = append(ifc.Methods, pMethod{Name: m})
+		}
+		return []pInterface{ifc}
+	}
+	tests := []struct {
+		name     string
+		from, to snapshot
+		want     snapshotDiff
+	}{
+		{
+			name: "no changes",
+			from: snapshot{Entries: []snapshotEntry{{Name: "a", Servers: server("/s1")}}},
+			to:   snapshot{Entries: []snapshotEntry{{Name: "a", Servers: server("/s1")}}},
+			want: snapshotDiff{},
+		},
+		{
+			name: "added and removed names",
+			from: snapshot{Entries: []snapshotEntry{{Name: "a"}, {Name: "b"}}},
+			to:   snapshot{Entries: []snapshotEntry{{Name: "b"}, {Name: "c"}, {Name: "d"}}},
+			want: snapshotDiff{Added: []string{"c", "d"}, Removed: []string{"a"}},
+		},
+		{
+			name: "servers and flags",
+			from: snapshot{Entries: []snapshotEntry{{Name: "a", Servers: []snapshotServer{{Server: "/s1"}, {Server: "/s2"}}}}},
+			to:   snapshot{Entries: []snapshotEntry{{Name: "a", Servers: []snapshotServer{{Server: "/s2"}, {Server: "/s3"}}, IsLeaf: true, ServesMountTable: true}}},
+			want: snapshotDiff{Changed: []entryChange{{
+				Name:           "a",
+				AddedServers:   []string{"/s3"},
+				RemovedServers: []string{"/s1"},
+				Flags:          []string{"servesMountTable: false -> true", "isLeaf: false -> true"},
+			}}},
+		},
+		{
+			name: "server deadlines are ignored",
+			from: snapshot{Entries: []snapshotEntry{{Name: "a", Servers: []snapshotServer{{Server: "/s1", Deadline: time.Unix(100, 0)}}}}},
+			to:   snapshot{Entries: []snapshotEntry{{Name: "a", Servers: []snapshotServer{{Server: "/s1", Deadline: time.Unix(200, 0)}}}}},
+			want: snapshotDiff{},
+		},
+		{
+			name: "permissions",
+			from: snapshot{WithPermissions: true, Entries: []snapshotEntry{{Name: "a", Permissions: readAlice}}},
+			to:   snapshot{WithPermissions: true, Entries: []snapshotEntry{{Name: "a", Permissions: readBob}}},
+			want: snapshotDiff{Changed: []entryChange{{
+				Name: "a",
+				Permissions: []permissionsChange{
+					{Pattern: "dev.v.io:u:bob", Tag: "Read", Change: "gains", List: "in"},
+					{Pattern: "dev.v.io:u:alice", Tag: "Read", Change: "loses", List: "in"},
+				},
+			}}},
+		},
+		{
+			name: "permissions recorded in one snapshot only",
+			from: snapshot{WithPermissions: true, Entries: []snapshotEntry{{Name: "a", Permissions: readAlice}}},
+			to:   snapshot{Entries: []snapshotEntry{{Name: "a"}}},
+			want: snapshotDiff{},
+		},
+		{
+			name: "unreadable permissions",
+			from: snapshot{WithPermissions: true, Entries: []snapshotEntry{{Name: "a", Permissions: readAlice}}},
+			to:   snapshot{WithPermissions: true, Entries: []snapshotEntry{{Name: "a", PermissionsErr: "no access"}}},
+			want: snapshotDiff{Changed: []entryChange{{
+				Name:       "a",
+				Unreadable: []string{"permissions unreadable in the newer snapshot: no access"},
+			}}},
+		},
+		{
+			name: "signatures",
+			from: snapshot{WithSignatures: true, Entries: []snapshotEntry{{Name: "a", Signature: sig("Get", "Put")}}},
+			to:   snapshot{WithSignatures: true, Entries: []snapshotEntry{{Name: "a", Signature: sig("Delete", "Get")}}},
+			want: snapshotDiff{Changed: []entryChange{{
+				Name: "a",
+				Signature: []signatureChange{
+					{Method: "v.io/x/store.Store.Delete", Change: "added"},
+					{Method: "v.io/x/store.Store.Put", Change: "removed"},
+				},
+			}}},
+		},
+		{
+			name: "unreadable signature",
+			from: snapshot{WithSignatures: true, Entries: []snapshotEntry{{Name: "a", SignatureErr: "timeout"}}},
+			to:   snapshot{WithSignatures: true, Entries: []snapshotEntry{{Name: "a", Signature: sig("Get")}}},
+			want: snapshotDiff{Changed: []entryChange{{
+				Name:       "a",
+				Unreadable: []string{"signature unreadable in the older snapshot: timeout"},
+			}}},
+		},
+		{
+			name: "names under a failed glob",
+			from: snapshot{
+				Entries: []snapshotEntry{{Name: "a"}, {Name: "a/b"}, {Name: "ab"}, {Name: "c"}},
+			},
+			to: snapshot{
+				Entries: []snapshotEntry{{Name: "c"}, {Name: "c/d"}},
+				Errors:  []snapshotError{{Name: "a", Err: "timeout"}},
+			},
+			want: snapshotDiff{Added: []string{"c/d"}, Removed: []string{"ab"}, Unreadable: []string{"a", "a/b"}},
+		},
+		{
+			name: "names under a glob that failed before",
+			from: snapshot{
+				Entries: []snapshotEntry{{Name: "c"}},
+				Errors:  []snapshotError{{Name: "c", Err: "timeout"}},
+			},
+			to:   snapshot{Entries: []snapshotEntry{{Name: "c"}, {Name: "c/d"}}},
+			want: snapshotDiff{Unreadable: []string{"c/d"}},
+		},
+	}
+	for _, test := range tests {
+		got := diffSnapshots(&test.from, &test.to)
+		want := test.want
+		for _, l := range []*[]string{&want.Added, &want.Removed, &want.Unreadable} {
+			if *l == nil {
+				*l = []string{}
+			}
+		}
+		if want.Changed == nil {
+			want.Changed = []entryChange{}
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, *got, want)
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	taken := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	diff := &snapshotDiff{
+		Name:       "a",
+		FromTaken:  taken,
+		ToTaken:    taken.Add(time.Hour),
+		Added:      []string{"a/new"},
+		Removed:    []string{"a/old"},
+		Unreadable: []string{"a/lost"},
+		Changed: []entryChange{{
+			Name:         "a/x",
+			AddedServers: []string{"/s2"},
+			Flags:        []string{"isLeaf: false -> true"},
+			Permissions:  []permissionsChange{{Pattern: "dev.v.io:u:bob", Tag: "Read", Change: "gains", List: "in"}},
+			Signature:    []signatureChange{{Method: "v.io/x/store.Store.Put", Change: "removed"}},
+			Unreadable:   []string{"signature unreadable in the newer snapshot: timeout"},
+		}},
+	}
+	tests := []struct {
+		diff *snapshotDiff
+		want string
+	}{
+		{
+			&snapshotDiff{Name: "a", FromTaken: taken, ToTaken: taken},
+			"Changes to a from 2016-05-01T12:00:00Z to 2016-05-01T12:00:00Z\nNo changes.\n",
+		},
+		{
+			diff,
+			`Changes to a from 2016-05-01T12:00:00Z to 2016-05-01T13:00:00Z
++ a/new
+- a/old
+? a/lost (could not be globbed in one of the snapshots)
+~ a/x
+    server added: /s2
+    isLeaf: false -> true
+    permissions: dev.v.io:u:bob gains Read (in)
+    method v.io/x/store.Store.Put: removed
+    signature unreadable in the newer snapshot: timeout
+`,
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeDiffText(&buf, test.diff); err != nil {
+			t.Errorf("writeDiffText failed: %v", err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("got\n%s\nwant\n%s", got, test.want)
+		}
+	}
+
+	// The JSON form lists every name the text does, and reads back the same.
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"added":["a/new"]`, `"removed":["a/old"]`, `"unreadable":["a/lost"]`, `"addedServers":["/s2"]`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("JSON diff %s does not contain %s", data, key)
+		}
+	}
+	var got snapshotDiff
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, diff) {
+		t.Errorf("JSON diff read back as %+v, want %+v", got, *diff)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"v.io/v23/naming"
+	"v.io/v23/security"
+)
+
+// globParams are the params of glob. They are either a pattern string, or an
+// object with the pattern and options that filter the results.
+type globParams struct {
+	Pattern string `json:"pattern"`
+
+	// If positive, entries more than MaxDepth names below the part of the
+	// pattern without wildcards are left out, and a trailing "..." is not
+	// walked any deeper.
+	MaxDepth int `json:"maxDepth"`
+
+	// If positive, the glob stops after MaxResults entries, and if there were
+	// more, its globEnd response is marked as truncated.
+	MaxResults int `json:"maxResults"`
+
+	// Leave out entries that are not leaves, or that are not mount tables.
+	LeafOnly       bool `json:"leafOnly"`
+	MountTableOnly bool `json:"mountTableOnly"`
+
+	// If set, only the entries whose name matches this regular expression are
+	// kept.
+	NameRegex string `json:"nameRegex"`
+
+	// If set, only the entries with a server whose endpoint has a blessing
+	// matched by this pattern are kept.
+	ServerBlessings security.BlessingPattern `json:"serverBlessings"`
+}
+
+// globFilter decides which glob entries are sent.
+type globFilter struct {
+	params    globParams
+	rootDepth int
+	nameRegex *regexp.Regexp
+}
+
+// parseGlobParams decodes the params of a glob request.
+func parseGlobParams(params string) (globParams, error) {
+	var data globParams
+	if err := json.Unmarshal([]byte(params), &data.Pattern); err == nil {
+		return data, nil
+	}
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return data, err
+	}
+	if data.Pattern == "" {
+		return data, fmt.Errorf("pattern is required")
+	}
+	return data, nil
+}
+
+func newGlobFilter(params globParams) (*globFilter, error) {
+	f := &globFilter{
+		params:    params,
+		rootDepth: nameDepth(globRoot(params.Pattern)),
+	}
+	if params.NameRegex != "" {
+		re, err := regexp.Compile(params.NameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("bad nameRegex: %v", err)
+		}
+		f.nameRegex = re
+	}
+	return f, nil
+}
+
+// match returns true if entry passes the filter.
+func (f *globFilter) match(entry *naming.MountEntry) bool {
+	p := f.params
+	switch {
+	case p.LeafOnly && !entry.IsLeaf:
+		return false
+	case p.MountTableOnly && !entry.ServesMountTable:
+		return false
+	case p.MaxDepth > 0 && nameDepth(entry.Name)-f.rootDepth > p.MaxDepth:
+		return false
+	case f.nameRegex != nil && !f.nameRegex.MatchString(entry.Name):
+		return false
+	case p.ServerBlessings != "" && !serverBlessingsMatch(entry, p.ServerBlessings):
+		return false
+	}
+	return true
+}
+
+// serverBlessingsMatch returns true if a server of entry has an endpoint with
+// a blessing matched by pattern.
+func serverBlessingsMatch(entry *naming.MountEntry, pattern security.BlessingPattern) bool {
+	for _, server := range entry.Servers {
+		address, _ := naming.SplitAddressName(server.Server)
+		ep, err := naming.ParseEndpoint(address)
+		if err != nil {
+			continue
+		}
+		if pattern.MatchedBy(ep.BlessingNames()...) {
+			return true
+		}
+	}
+	return false
+}
+
+// boundedPatterns returns the patterns to glob for params. A pattern that
+// ends with "..." walks every mount table below it, so if params.MaxDepth is
+// set, it is replaced by one pattern per depth down to MaxDepth, e.g.
+// "house/..." with MaxDepth 2 by "house", "house/*" and "house/*/*". Other
+// patterns are globbed as they are.
+func boundedPatterns(params globParams) []string {
+	pattern := params.Pattern
+	if params.MaxDepth <= 0 || (pattern != "..." && !strings.HasSuffix(pattern, "/...")) {
+		return []string{pattern}
+	}
+	prefix := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	// The depth of "..." itself, below the part without wildcards.
+	depth := nameDepth(prefix) - nameDepth(globRoot(pattern))
+
+	var patterns []string
+	if prefix != "" {
+		patterns = append(patterns, prefix)
+	}
+	for p := prefix; depth < params.MaxDepth; depth++ {
+		p = naming.Join(p, "*")
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// globRoot returns the part of a glob pattern before its first wildcard.
+func globRoot(pattern string) string {
+	var elems []string
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem == "..." || strings.ContainsAny(elem, "*?[") {
+			break
+		}
+		elems = append(elems, elem)
+	}
+	return strings.Join(elems, "/")
+}
+
+// nameDepth returns the number of elements of a name.
+func nameDepth(name string) int {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return 0
+	}
+	return strings.Count(name, "/") + 1
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"v.io/v23/naming"
+	"v.io/v23/security"
+)
+
+func TestParseGlobParams(t *testing.T) {
+	tests := []struct {
+		params string
+		want   globParams
+		err    bool
+	}{
+		{`"a/*"`, globParams{Pattern: "a/*"}, false},
+		{`{"pattern":"a/...","maxDepth":2,"maxResults":10}`, globParams{Pattern: "a/...", MaxDepth: 2, MaxResults: 10}, false},
+		{`{"pattern":"...","leafOnly":true,"nameRegex":"^a"}`, globParams{Pattern: "...", LeafOnly: true, NameRegex: "^a"}, false},
+		{`{"maxDepth":2}`, globParams{}, true},
+		{`[1]`, globParams{}, true},
+	}
+	for _, test := range tests {
+		got, err := parseGlobParams(test.params)
+		if (err != nil) != test.err {
+			t.Errorf("parseGlobParams(%s): got error %v, want error %v", test.params, err, test.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseGlobParams(%s): got %+v, want %+v", test.params, got, test.want)
+		}
+	}
+}
+
+func TestBoundedPatterns(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		maxDepth int
+		want     []string
+	}{
+		{"house/...", 0, []string{"house/..."}},
+		{"house/...", 1, []string{"house", "house/*"}},
+		{"house/...", 2, []string{"house", "house/*", "house/*/*"}},
+		{"...", 2, []string{"*", "*/*"}},
+		// The depth is counted from the part of the pattern without wildcards.
+		{"house/*/...", 1, []string{"house/*"}},
+		{"house/*/...", 2, []string{"house/*", "house/*/*"}},
+		// Other patterns are bounded by the filter alone.
+		{"house/*", 1, []string{"house/*"}},
+		{"house/kitchen", 3, []string{"house/kitchen"}},
+		{"house/...x", 2, []string{"house/...x"}},
+	}
+	for _, test := range tests {
+		got := boundedPatterns(globParams{Pattern: test.pattern, MaxDepth: test.maxDepth})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("boundedPatterns(%q, maxDepth %d): got %q, want %q", test.pattern, test.maxDepth, got, test.want)
+		}
+	}
+}
+
+func TestGlobRoot(t *testing.T) {
+	tests := []struct {
+		pattern, root string
+		depth         int
+	}{
+		{"...", "", 0},
+		{"*", "", 0},
+		{"house/...", "house", 1},
+		{"house/kitchen/*", "house/kitchen", 2},
+		{"house/k?tchen/...", "house", 1},
+		{"house/[a-k]*/...", "house", 1},
+		{"house/kitchen", "house/kitchen", 2},
+	}
+	for _, test := range tests {
+		root := globRoot(test.pattern)
+		if root != test.root {
+			t.Errorf("globRoot(%q): got %q, want %q", test.pattern, root, test.root)
+		}
+		if depth := nameDepth(root); depth != test.depth {
+			t.Errorf("nameDepth(%q): got %d, want %d", root, depth, test.depth)
+		}
+	}
+}
+
+func TestGlobFilter(t *testing.T) {
+	leaf := &naming.MountEntry{Name: "house/kitchen/lights", IsLeaf: true}
+	mountTable := &naming.MountEntry{Name: "house/kitchen", ServesMountTable: true}
+	deep := &naming.MountEntry{Name: "house/a/b/c", IsLeaf: true}
+	root := &naming.MountEntry{Name: "house", ServesMountTable: true}
+	tests := []struct {
+		params globParams
+		entry  *naming.MountEntry
+		want   bool
+	}{
+		{globParams{Pattern: "house/..."}, leaf, true},
+		{globParams{Pattern: "house/...", LeafOnly: true}, leaf, true},
+		{globParams{Pattern: "house/...", LeafOnly: true}, mountTable, false},
+		{globParams{Pattern: "house/...", MountTableOnly: true}, mountTable, true},
+		{globParams{Pattern: "house/...", MountTableOnly: true}, leaf, false},
+		{globParams{Pattern: "house/...", MaxDepth: 1}, root, true},
+		{globParams{Pattern: "house/...", MaxDepth: 1}, mountTable, true},
+		{globParams{Pattern: "house/...", MaxDepth: 1}, leaf, false},
+		{globParams{Pattern: "house/...", MaxDepth: 2}, leaf, true},
+		{globParams{Pattern: "house/...", MaxDepth: 2}, deep, false},
+		{globParams{Pattern: "house/kitchen/...", MaxDepth: 1}, leaf, true},
+		{globParams{Pattern: "house/...", NameRegex: "lights$"}, leaf, true},
+		{globParams{Pattern: "house/...", NameRegex: "lights$"}, mountTable, false},
+		{globParams{Pattern: "house/...", NameRegex: "^house/a/"}, deep, true},
+		{globParams{Pattern: "house/...", LeafOnly: true, NameRegex: "kitchen"}, mountTable, false},
+		// Entries without servers have no blessings.
+		{globParams{Pattern: "house/...", ServerBlessings: "dev.v.io:u:alice"}, leaf, false},
+	}
+	for _, test := range tests {
+		f, err := newGlobFilter(test.params)
+		if err != nil {
+			t.Errorf("newGlobFilter(%+v) failed: %v", test.params, err)
+			continue
+		}
+		if got := f.match(test.entry); got != test.want {
+			t.Errorf("%+v matching %q: got %v, want %v", test.params, test.entry.Name, got, test.want)
+		}
+	}
+
+	if _, err := newGlobFilter(globParams{Pattern: "...", NameRegex: "("}); err == nil {
+		t.Errorf("newGlobFilter with a bad nameRegex did not fail")
+	}
+}
+
+func TestServerBlessingsMatch(t *testing.T) {
+	alice := "@6@tcp@127.0.0.1:8101@@00000000000000000000000000000000@s@dev.v.io:u:alice@@"
+	bob := "@6@tcp@127.0.0.1:8102@@00000000000000000000000000000000@s@dev.v.io:u:bob@@"
+	entry := func(servers ...string) *naming.MountEntry {
+		e := &naming.MountEntry{Name: "house/lights"}
+		for _, s := range servers {
+			e.Servers = append(e.Servers, naming.MountedServer{Server: "/" + s})
+		}
+		return e
+	}
+	tests := []struct {
+		entry   *naming.MountEntry
+		pattern string
+		want    bool
+	}{
+		{entry(alice), "dev.v.io:u:alice", true},
+		{entry(alice), "dev.v.io:u", true},
+		{entry(alice), "dev.v.io:u:bob", false},
+		{entry(bob, alice), "dev.v.io:u:alice", true},
+		{entry(), "dev.v.io:u:alice", false},
+		{entry("127.0.0.1:8101"), "dev.v.io:u:alice", false},
+	}
+	for _, test := range tests {
+		f, err := newGlobFilter(globParams{Pattern: "house/...", ServerBlessings: security.BlessingPattern(test.pattern)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.match(test.entry); got != test.want {
+			t.Errorf("servers %v matching %q: got %v, want %v", test.entry.Servers, test.pattern, got, test.want)
+		}
+	}
+}
@@ -5,53 +5,70 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"v.io/v23"
 	"v.io/v23/context"
-	"v.io/v23/namespace"
 	"v.io/v23/naming"
-	"v.io/v23/rpc"
-	"v.io/v23/vdl"
-	"v.io/v23/vdlroot/signature"
 
 	_ "v.io/x/ref/runtime/factories/roaming"
 )
 
-const (
-	RPC_TIMEOUT = 15 // 15 seconds per RPC
-
-	// TODO(alexfandrianto): Make this configurable here and on the JS end.
-	// https://github.com/vanadium/issues/issues/1268
-	SERVER_ADDRESS = "localhost:9002"
-	WEB_SERVER_ADDRESS = "localhost:9001"
-	HTML_DIR = "public"
-)
-
 type NamespaceBrowser struct {
 	// The base Vanadium context. Used for all RPCs.
-	ctx       *context.T
-	namespace namespace.T
-	client    rpc.Client
+	ctx        *context.T
+	namespaces *namespaces
+	config     *config
+	streams    *rpcStreams
+	cache      *nsCache
+
+	deleteTokens *deleteTokens
 }
 
 // NamespaceBrowser factory
-func NewNamespaceBrowser(ctx *context.T) *NamespaceBrowser {
+func NewNamespaceBrowser(ctx *context.T, config *config) *NamespaceBrowser {
 	return &NamespaceBrowser{
-		ctx:       ctx,
-		namespace: v23.GetNamespace(ctx),
-		client:    v23.GetClient(ctx),
+		ctx:        ctx,
+		namespaces: newNamespaces(ctx, config.MaxRootSets),
+		config:     config,
+		streams:    newRPCStreams(),
+		cache:      newNSCache(time.Duration(config.CacheTTL)),
+
+		deleteTokens: newDeleteTokens(),
 	}
 }
 
-func (b *NamespaceBrowser) timed() *context.T {
-	ctx, _ := context.WithTimeout(b.ctx, RPC_TIMEOUT*time.Second)
-	return ctx
+// requestContext returns a context that lives as long as an HTTP request: it
+// is canceled with the context of req, i.e. when the client disconnects, or
+// when the returned cancel func is called once the request has been served.
+// Vanadium operations made for the request should derive their contexts from
+// it. It acts as the profile of opts, and uses the namespace of its roots, or
+// the defaults if they are empty. They are reported to the client in the
+// X-Browser-Profile and X-Namespace-Roots headers.
+func (b *NamespaceBrowser) requestContext(rw http.ResponseWriter, req *http.Request, opts requestOptions) (*context.T, context.CancelFunc, error) {
+	base, err := b.namespaces.context(opts.Profile, opts.Roots)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(base)
+	go func() {
+		select {
+		case <-req.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	reportScope(rw, ctx)
+	return ctx, cancel, nil
 }
 
 func writeAndFlush(rw http.ResponseWriter, data interface{}) {
@@ -76,34 +93,111 @@ func extractJsonString(params string) (s string, err error) {
 	return
 }
 
-func extractJsonMap(params string) (m map[string]interface{}, err error) {
-	err = json.Unmarshal([]byte(params), &m)
-	return
-}
-
 /* ServeHTTP must handle EventSource requests from the browser.
  * The requests have a "request" and "params" portion.
  * The format is as follows:
  *
  * accountName: <no parameters>  => { accountName: <string>, err: <err> }
- * glob: string pattern  => a stream of responses
- *   { globRes: <glob res>, globErr: <glob err>, globEnd: <bool>, err: <err> }
- * permissions: string name =>  { permissions: <permissions>, err: <err> }
+ * policy: <no parameters> => { readOnly: <bool>, allowedTags: []<string>,
+ *   err: <err> } (see checkPolicy)
+ * profiles: <no parameters> => { profiles: []{ name: <string>,
+ *   credentials: <dir>, publicKey: <string>, blessings: []<string> },
+ *   err: <err> }
+ * principal: <no parameters> => { profile: <string>, publicKey: <string>,
+ *   default: <stored blessing>, blessings: []{ peerPattern: <pattern>,
+ *   names: []<string>, chains: []<blessing chain>, expiry: <time>,
+ *   expiresIn: <string>, expired: <bool> }, roots: []{ pattern: <pattern>,
+ *   publicKey: <string>, der: <base64> }, err: <err> } (see storedBlessing)
+ * setDefaultBlessing: { blessing: <string> } => same as principal
+ * addRoot: { publicKey: <base64 DER>, pattern: <pattern> } => same as
+ *   principal
+ * glob: string pattern, or { pattern: <string>, maxDepth: <int>,
+ *       maxResults: <int>, leafOnly: <bool>, mountTableOnly: <bool>,
+ *       nameRegex: <string>, serverBlessings: <pattern> } (see globParams)
+ *   => a stream of responses { globRes: <glob res>, globErr: <glob err>,
+ *      globEnd: <bool>, truncated: <bool>, err: <err> }
+ * permissions: string name =>
+ *   { permissions: <permissions>, version: <string>, err: <err> }
+ * setPermissions: { name: <string>, permissions: <permissions>,
+ *                   version: <string>, force: <bool>, dryRun: <bool> } =>
+ *   { version: <string>, changes: []{ pattern: <string>, tag: <string>,
+ *     change: "gains"|"loses", list: "in"|"notIn" }, err: <err> }
+ * explainAccess: { name: <string>, blessings: []<string> } =>
+ *   { blessings: []<string>, tags: []{ tag: <string>, granted: <bool>,
+ *     reason: <string>, blessings: []{ blessing: <string>,
+ *     grantedBy: <pattern>, deniedBy: <pattern> } }, err: <err> }
  * deleteMountPoint: string name => { err: <err string> }
+ *   (fails if the name has children; see deleteTree)
+ * watch: { pattern: <string>, interval: <string>, and the glob options } =>
+ *   a stream of responses { event: "added"|"removed"|"changed",
+ *   entry: <mount entry>, synced: <bool>, watchEnd: <bool>, err: <err> }
+ *   (see watch)
+ * deleteTree: { name: <string>, dryRun: <bool>, token: <string> } =>
+ *   a stream of responses { name: <string>, deleted: <bool>, token: <string>,
+ *   deleteEnd: <bool>, err: <err> } (see deleteTree)
+ * mount: { name: <string>, server: <string>, ttl: <string>,
+ *          servesMountTable: <bool>, isLeaf: <bool>, replace: <bool> } =>
+ *        { err: <err> }
+ * unmount: { name: <string>, server: <string> } => { err: <err> }
+ *          (an empty server unmounts all the servers at name)
  * resolveToMounttable: string name => { addresses: []<string>, err: <err> }
  * objectAddresses: string name => { addresses: []<string>, err: <err> }
- * remoteBlessings: string name => { blessings: []<string>, err: <err> }
+ * remoteBlessings: string name => { blessings: []<string>,
+ *   publicKey: <string>, chains: []<blessing chain>, rejected: []{
+ *   blessing: <string>, reason: <string> }, err: <err> } (see blessingChain)
  * signature: string name => { signature: <signature>, err: <err> }
- * makeRPC: { name: <string>, methodName: <string>, args: []<string>,
- *            numOutArgs: <int> } =>
- *          { response: <undefined, output, OR []outputs>, err: <err> }
+ * makeRPC: { name: <string>, methodName: <string>, args: []<JSON> } =>
+ *          { response: []{ value: <JSON>, type: <type> }, err: <err> }
+ * streamRPC: same params as makeRPC => a stream of responses
+ *   { streamId: <string>, item: { value: <JSON>, type: <type> },
+ *     response: []{ value: <JSON>, type: <type> },
+ *     streamEnd: <bool>, err: <err> } (see streamRPC)
+ * snapshot: { name: <string>, permissions: <bool>, signatures: <bool> } =>
+ *   { snapshot: <snapshot>, err: <err> } (see takeSnapshot)
+ * record: same params as snapshot =>
+ *   { recording: { id: <string>, name: <string>, taken: <time>,
+ *     entries: <int> }, err: <err> }
+ * recordings: <no parameters> => { recordings: []<recording>, err: <err> }
+ * diff: { from: <recording id>, to: <recording id, or empty for live> } =>
+ *   { diff: <diff>, text: <string>, err: <err> } (see snapshotDiff)
+ * cacheStats: <no parameters> => { stats: { hits: { <kind>: <int> },
+ *   misses: { <kind>: <int> }, entries: { <kind>: <int> } }, err: <err> }
+ * clearCache: { name: <string> } => same as cacheStats. Clears the cached
+ *   results related to name, or all of them if name is empty.
+ * streamSend: { streamId: <string>, item: <item> } => { err: <err> }
+ * streamCloseSend: { streamId: <string> } => { err: <err> }
+ *
+ * Every request also accepts the optional query parameters timeout, e.g.
+ * "30s", retries, the number of retries after transient errors, profile,
+ * the credentials to act as, and roots, the comma-separated namespace roots
+ * to use instead of the default ones. See requestOptions. The profile and
+ * roots used are reported in the X-Browser-Profile and X-Namespace-Roots
+ * headers.
+ *
+ * Every request must come from an allowed origin and present the API token;
+ * see authorize. Requests refused by the policy of the daemon, e.g. in
+ * read-only mode, fail with a policy error; see checkPolicy.
+ *
+ * Requests under REST_PATH are served as plain JSON instead; see serveREST.
+ * A WebSocket at WS_PATH carries many requests at once; see serveWebSocket.
  */
 func (b *NamespaceBrowser) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !b.authorize(rw, req) {
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, REST_PATH) {
+		b.serveREST(rw, req)
+		return
+	}
+	if req.URL.Path == WS_PATH {
+		b.serveWebSocket(rw, req)
+		return
+	}
+
 	// Set the headers related to event streaming.
 	rw.Header().Set("Content-Type", "text/event-stream")
 	rw.Header().Set("Cache-Control", "no-cache")
 	rw.Header().Set("Connection", "keep-alive")
-	rw.Header().Set("Access-Control-Allow-Origin", "*")
 
 	request, err := url.QueryUnescape(req.FormValue("request"))
 	if err != nil {
@@ -116,185 +210,453 @@ func (b *NamespaceBrowser) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	opts, err := requestOptionsFrom(req)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	fmt.Println("request", request, "params", params)
 
+	// Stop writing once the client is gone; the operation is canceled too.
+	reqCtx, cancel, err := b.requestContext(rw, req, opts)
+	if err != nil {
+		writeAndFlush(rw, errorReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer cancel()
+	send := func(data interface{}) {
+		if reqCtx.Err() == nil {
+			writeAndFlush(rw, data)
+		}
+	}
+	ctx, cancelTimed := b.timed(reqCtx, request, opts)
+	defer cancelTimed()
+
 	// The response depends on the request type.
 	switch request {
-	case "accountName":
-		// Obtain the default blessing and return that.
-		blessing, _ := v23.GetPrincipal(b.ctx).BlessingStore().Default()
-		writeAndFlush(rw, accountNameReturn{AccountName: blessing.String()})
 	case "glob":
-		pattern, err := extractJsonString(params)
+		globParams, err := parseGlobParams(params)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
-		// Obtain the glob stream.
-		globCh, err := b.namespace.Glob(b.timed(), pattern)
-		if err != nil {
-			writeAndFlush(rw, globReturn{Err: fmt.Sprintf("%v", err)})
+		b.cachedGlob(ctx, globParams, opts, func(res globReturn) {
+			send(res)
+		})
+	case "streamRPC":
+		b.streamRPC(ctx, params, func(res streamRPCReturn) {
+			send(res)
+		})
+	case "deleteTree":
+		b.deleteTree(ctx, params, opts, func(res deleteTreeReturn) {
+			send(res)
+		})
+	case "watch":
+		b.watch(ctx, params, opts, func(res watchReturn) {
+			send(res)
+		})
+	default:
+		res, err := b.handleWithRetries(ctx, request, params, opts)
+		if err == errUnknownRequest {
+			send("Please connect from the namespace browser.")
 			return
 		}
+		if _, ok := err.(badParamsError); ok {
+			fmt.Println(err)
+			return
+		}
+		send(res)
+	}
+}
 
-		// Afterwards, go through the stream and forward results and errors.
-		writeAndFlush(rw, globReturn{})
+// streamGlob performs a glob and passes its responses to send: first an empty
+// response once the glob has started (or one with the error if it could not),
+// then each result that passes the filters of params and each error, and
+// finally one with globEnd set. If results were left out because the glob
+// stopped at params.MaxResults, the last response is marked as truncated. The
+// error of starting the glob is also returned.
+//
+// If params.MaxDepth is set, the mount tables are not walked deeper than
+// that; see boundedPatterns.
+func (b *NamespaceBrowser) streamGlob(ctx *context.T, params globParams, opts requestOptions, send func(globReturn)) error {
+	filter, err := newGlobFilter(params)
+	if err != nil {
+		send(globReturn{Err: fmt.Sprintf("bad params: %v", err)})
+		return badParamsError{err}
+	}
+
+	// Obtain the glob streams. They are canceled once enough results are
+	// found.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	started := false
+	results, truncated := 0, false
+	globErrs := map[string]bool{} // The names that failed, reported once.
+	for _, pattern := range boundedPatterns(params) {
+		if truncated {
+			break
+		}
+		var globCh <-chan naming.GlobReply
+		err = b.withRetries(ctx, opts, func() (err error) {
+			globCh, err = v23.GetNamespace(ctx).Glob(ctx, pattern)
+			return err
+		})
+		if err != nil && !started {
+			send(globReturn{Err: fmt.Sprintf("%v", err)})
+			return err
+		}
+		if !started {
+			send(globReturn{})
+			started = true
+		}
+		if err != nil {
+			send(globReturn{GlobErr: &naming.GlobError{Name: pattern, Error: err}})
+			continue
+		}
+
+		// Go through the stream and forward results and errors.
 		for entry := range globCh { // These GlobReply could be a reply or an error.
+			if truncated {
+				continue // Drain the stream until the canceled glob closes it.
+			}
 			switch v := entry.(type) {
 			case *naming.GlobReplyEntry:
-				writeAndFlush(rw, globReturn{GlobRes: &v.Value})
+				if !filter.match(&v.Value) {
+					continue
+				}
+				if params.MaxResults > 0 && results >= params.MaxResults {
+					truncated = true
+					cancel()
+					continue
+				}
+				send(globReturn{GlobRes: &v.Value})
+				results++
 			case *naming.GlobReplyError:
-				writeAndFlush(rw, globReturn{GlobErr: &v.Value})
+				if globErrs[v.Value.Name] {
+					continue
+				}
+				globErrs[v.Value.Name] = true
+				send(globReturn{GlobErr: &v.Value})
 			}
 		}
-		writeAndFlush(rw, globReturn{GlobEnd: true})
+	}
+	send(globReturn{GlobEnd: true, Truncated: truncated})
+	return nil
+}
+
+var errUnknownRequest = errors.New("unknown request")
+
+// badParamsError is returned by handle when the params of a request cannot
+// be decoded.
+type badParamsError struct {
+	error
+}
+
+// handleWithRetries performs a request with handle, and retries it as the
+// options allow if it fails with a transient error and is one of the
+// retriedRequests. Other requests are tried once.
+func (b *NamespaceBrowser) handleWithRetries(ctx *context.T, request, params string, opts requestOptions) (res interface{}, err error) {
+	if !retriedRequests[request] {
+		return b.handle(ctx, request, params, opts)
+	}
+	b.withRetries(ctx, opts, func() error {
+		res, err = b.handle(ctx, request, params, opts)
+		return err
+	})
+	return res, err
+}
+
+/* handle performs a request that has a single response, i.e. every request
+ * described at ServeHTTP other than glob, watch, streamRPC and deleteTree.
+ * The params are JSON-encoded.
+ *
+ * The response is the *Return value for the request type. If the request
+ * failed, its err field is set and the error is returned too, so that callers
+ * can tell failures apart. The options are those of the request; its timeout
+ * already bounds ctx.
+ */
+func (b *NamespaceBrowser) handle(ctx *context.T, request, params string, opts requestOptions) (interface{}, error) {
+	if err := b.checkPolicy(request, params); err != nil {
+		return errorReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	switch request {
+	case "accountName":
+		// Obtain the default blessing and return that.
+		blessing, _ := v23.GetPrincipal(ctx).BlessingStore().Default()
+		return accountNameReturn{AccountName: blessing.String()}, nil
 	case "deleteMountPoint":
 		name, err := extractJsonString(params)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, badParamsError{err}
 		}
 
-		// Delete the chosen name from the namespace.
-		err = b.namespace.Delete(b.timed(), name, true)
+		// Delete the chosen name from the namespace. It fails if the name
+		// has children; they are deleted with deleteTree.
+		err = v23.GetNamespace(ctx).Delete(ctx, name, false)
+		b.cache.invalidate(name)
 		if err != nil {
-			writeAndFlush(rw, deleteReturn{Err: fmt.Sprintf("%v", err)})
-			return
+			return deleteReturn{Err: fmt.Sprintf("%v", err)}, err
 		}
-		writeAndFlush(rw, deleteReturn{})
+		return deleteReturn{}, nil
+	case "mount":
+		return b.mount(ctx, params)
+	case "unmount":
+		return b.unmount(ctx, params)
 	case "resolveToMounttable":
 		name, err := extractJsonString(params)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, badParamsError{err}
+		}
+
+		scope := cacheScope(ctx)
+		if res, ok := b.cache.get(request, scope, name); ok {
+			return res, nil
 		}
 
 		// Use the MountEntry for this name to find its server addresses.
-		entry, err := b.namespace.ResolveToMountTable(b.timed(), name)
+		entry, err := v23.GetNamespace(ctx).ResolveToMountTable(ctx, name)
 		if err != nil {
-			writeAndFlush(rw, addressesReturn{Err: fmt.Sprintf("%v", err)})
-			return
+			return addressesReturn{Err: fmt.Sprintf("%v", err)}, err
 		}
 		addrs := []string{}
 		for _, server := range entry.Servers {
 			addrs = append(addrs, server.Server)
 		}
-		writeAndFlush(rw, addressesReturn{Addresses: addrs})
+		res := addressesReturn{Addresses: addrs}
+		b.cache.put(request, scope, name, name, res, entry.Servers)
+		return res, nil
 	case "objectAddresses":
 		name, err := extractJsonString(params)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, badParamsError{err}
+		}
+
+		scope := cacheScope(ctx)
+		if res, ok := b.cache.get(request, scope, name); ok {
+			return res, nil
 		}
 
 		// Use the MountEntry for this name to find its object addresses.
-		entry, err := b.namespace.Resolve(b.timed(), name)
+		entry, err := v23.GetNamespace(ctx).Resolve(ctx, name)
 		if err != nil {
-			writeAndFlush(rw, addressesReturn{Err: fmt.Sprintf("%v", err)})
-			return
+			return addressesReturn{Err: fmt.Sprintf("%v", err)}, err
 		}
 		addrs := []string{}
 		for _, server := range entry.Servers {
 			addrs = append(addrs, server.Server)
 		}
-		writeAndFlush(rw, addressesReturn{Addresses: addrs})
+		res := addressesReturn{Addresses: addrs}
+		b.cache.put(request, scope, name, name, res, entry.Servers)
+		return res, nil
 	case "permissions":
 		name, err := extractJsonString(params)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, badParamsError{err}
 		}
-
-		// Obtain the mount table permissions at this name.
-		perms, _, err := b.namespace.GetPermissions(b.timed(), name)
-		if err != nil {
-			writeAndFlush(rw, permissionsReturn{Err: fmt.Sprintf("%v", err)})
-			return
-		}
-		writeAndFlush(rw, permissionsReturn{Permissions: perms})
+		return b.getPermissions(ctx, name)
+	case "setPermissions":
+		return b.setPermissions(ctx, params)
+	case "explainAccess":
+		return b.explainAccess(ctx, params)
 	case "remoteBlessings":
 		name, err := extractJsonString(params)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, badParamsError{err}
 		}
 
 		// Obtain the remote blessings for the server running at this name.
-		clientCall, err := b.client.StartCall(b.timed(), name, rpc.ReservedMethodSignature, nil)
-		defer clientCall.Finish()
-
-		if err != nil {
-			writeAndFlush(rw, blessingsReturn{Err: fmt.Sprintf("%v", err)})
-			return
-		}
-		rbs, _ := clientCall.RemoteBlessings()
-		writeAndFlush(rw, blessingsReturn{Blessings: rbs})
+		return b.remoteBlessings(ctx, name)
 	case "signature":
 		name, err := extractJsonString(params)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, badParamsError{err}
 		}
+		return b.getSignature(ctx, name)
+	case "makeRPC":
+		var data rpcParams
+		if err := json.Unmarshal([]byte(params), &data); err != nil {
+			return nil, badParamsError{err}
+		}
+		fmt.Printf("Make RPC: %s %s %s\n", data.Name, data.MethodName, params)
 
-		// Obtain the signature(s) of the server running at this name.
-		var sig []signature.Interface
-		err = b.client.Call(b.timed(), name, rpc.ReservedSignature, nil, []interface{}{&sig})
+		// Convert the args to the types in the method's signature. This
+		// also rejects unknown methods before the call is made.
+		method, inargs, err := b.typedInArgs(ctx, data)
 		if err != nil {
-			writeAndFlush(rw, signatureReturn{Err: fmt.Sprintf("%v", err)})
-			return
+			return makeRPCReturn{Err: fmt.Sprintf("%v", err)}, err
 		}
-		convertedSig := convertSignature(sig)
-		writeAndFlush(rw, signatureReturn{Signature: convertedSig})
-	case "makeRPC":
-		data, err := extractJsonMap(params)
-		if err != nil {
-			fmt.Println(err)
-			return
+		if err := b.checkMethodPolicy(method); err != nil {
+			return makeRPCReturn{Err: fmt.Sprintf("%v", err)}, err
 		}
-		name := data["name"].(string)
-		method := data["methodName"].(string)
-		params := data["args"].([]interface{})
-		fmt.Printf("Make RPC: %s %s %v\n", name, method, params)
-		numOutArgs := int(data["numOutArgs"].(float64))
 
-		// Prepare outargs as *vdl.Value
-		outargs := make([]*vdl.Value, numOutArgs)
-		outptrs := make([]interface{}, numOutArgs)
-		for i := range outargs {
-			outptrs[i] = &outargs[i]
-		}
+		// Prepare outargs as *vdl.Value, one per out-arg in the signature.
+		outargs, outptrs := makeOutArgs(method)
 
 		// Make the call to name's method with the given params.
-		err = b.client.Call(b.timed(), name, method, params, outptrs)
+		err = v23.GetClient(ctx).Call(ctx, data.Name, data.MethodName, inargs, outptrs)
 		if err != nil {
-			writeAndFlush(rw, makeRPCReturn{Err: fmt.Sprintf("%v", err)})
-			return
+			return makeRPCReturn{Err: fmt.Sprintf("%v", err)}, err
 		}
 
-		// Convert the *vdl.Value outputs to readable strings
-		resStrings := []string{}
-		for _, outarg := range outargs {
-			resStrings = append(resStrings, outarg.String())
+		return makeRPCReturn{Response: convertResults(outargs)}, nil
+	case "snapshot":
+		var data snapshotParams
+		if err := json.Unmarshal([]byte(params), &data); err != nil {
+			return nil, badParamsError{err}
 		}
-		writeAndFlush(rw, makeRPCReturn{Response: resStrings})
-	default:
-		writeAndFlush(rw, "Please connect from the namespace browser.")
+		snap, err := b.takeSnapshot(ctx, data, opts)
+		if err != nil {
+			return snapshotReturn{Err: fmt.Sprintf("%v", err)}, err
+		}
+		return snapshotReturn{Snapshot: snap}, nil
+	case "record":
+		var data snapshotParams
+		if err := json.Unmarshal([]byte(params), &data); err != nil {
+			return nil, badParamsError{err}
+		}
+		info, err := b.record(ctx, data, opts)
+		if err != nil {
+			return recordReturn{Err: fmt.Sprintf("%v", err)}, err
+		}
+		return recordReturn{Recording: &info}, nil
+	case "recordings":
+		infos, err := b.recordings()
+		if err != nil {
+			return recordingsReturn{Err: fmt.Sprintf("%v", err)}, err
+		}
+		return recordingsReturn{Recordings: infos}, nil
+	case "diff":
+		var data diffParams
+		if err := json.Unmarshal([]byte(params), &data); err != nil {
+			return nil, badParamsError{err}
+		}
+		diff, err := b.diff(ctx, data)
+		if err != nil {
+			return diffReturn{Err: fmt.Sprintf("%v", err)}, err
+		}
+		var text bytes.Buffer
+		writeDiffText(&text, diff)
+		return diffReturn{Diff: diff, Text: text.String()}, nil
+	case "profiles":
+		return profilesReturn{Profiles: b.profiles()}, nil
+	case "policy":
+		return b.policy(), nil
+	case "principal":
+		return b.principal(ctx)
+	case "setDefaultBlessing":
+		return b.setDefaultBlessing(ctx, params)
+	case "addRoot":
+		return b.addRoot(ctx, params)
+	case "cacheStats":
+		return cacheStatsReturn{Stats: b.cache.stats()}, nil
+	case "clearCache":
+		var data clearCacheParams
+		if err := json.Unmarshal([]byte(params), &data); err != nil {
+			return nil, badParamsError{err}
+		}
+		b.cache.invalidate(data.Name)
+		return cacheStatsReturn{Stats: b.cache.stats()}, nil
+	case "streamSend":
+		return b.streamSend(params)
+	case "streamCloseSend":
+		return b.streamCloseSend(params)
+	}
+	return nil, errUnknownRequest
+}
+
+// getPermissions returns the mount table permissions at name.
+func (b *NamespaceBrowser) getPermissions(ctx *context.T, name string) (permissionsReturn, error) {
+	perms, version, err := v23.GetNamespace(ctx).GetPermissions(ctx, name)
+	if err != nil {
+		return permissionsReturn{Err: fmt.Sprintf("%v", err)}, err
 	}
+	return permissionsReturn{Permissions: perms, Version: version}, nil
+}
 
-	// I think this keeps the connection open until the other side closes it?
-	notify := rw.(http.CloseNotifier).CloseNotify()
-	<-notify
+// getSignature returns the signature(s) of the server running at name.
+func (b *NamespaceBrowser) getSignature(ctx *context.T, name string) (signatureReturn, error) {
+	sig, err := b.serverSignature(ctx, name)
+	if err != nil {
+		return signatureReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	return signatureReturn{Signature: convertSignature(sig)}, nil
 }
 
 func main() {
 	ctx, shutdown := v23.Init()
 	defer shutdown()
-		fmt.Printf("\nPlease Visit http://%s to see Namespace Browser.\n\n", WEB_SERVER_ADDRESS)
+
+	if configFile != "" {
+		if err := cfg.load(configFile); err != nil {
+			log.Fatal("Config error: ", err)
+		}
+	}
+	browser := NewNamespaceBrowser(ctx, cfg)
+	if err := browser.loadProfiles(); err != nil {
+		log.Fatal("Profile error: ", err)
+	}
+	browser.warnExpiry()
+
+	cfg.token = cfg.APIToken
+	if cfg.token == "" {
+		token, err := randomID()
+		if err != nil {
+			log.Fatal("Cannot make an API token: ", err)
+		}
+		cfg.token = token
+	}
+
+	if snapshotName != "" {
+		if err := snapshotMain(browser); err != nil {
+			log.Fatal("Snapshot error: ", err)
+		}
+		return
+	}
+	if diffFrom != "" {
+		if err := diffMain(browser); err != nil {
+			log.Fatal("Diff error: ", err)
+		}
+		return
+	}
+
+	go browser.watchExpiry(expiryCheckInterval)
+
+	// The web server serves the static files and tells the JS app where the
+	// API is. In single-port mode, it serves the API too.
+	web := http.NewServeMux()
+	web.Handle("/", http.FileServer(http.Dir(cfg.HTMLDir)))
+	web.HandleFunc(CLIENT_CONFIG_PATH, cfg.serveClientConfig)
+
+	var tlsConfig *tls.Config
+	scheme := "http"
+	if cfg.useTLS() {
+		var err error
+		if tlsConfig, err = cfg.tlsConfig(); err != nil {
+			log.Fatal("TLS error: ", err)
+		}
+		scheme = "https"
+	}
+	if cfg.RedirectAddress != "" {
+		if tlsConfig == nil {
+			log.Fatal("-http-redirect-addr requires TLS")
+		}
+		go func() {
+			log.Fatal("Redirect server error: ", listenAndServe(cfg.RedirectAddress, http.HandlerFunc(cfg.redirectToHTTPS), nil))
+		}()
+	}
+
+	fmt.Printf("\nPlease Visit %s://%s to see Namespace Browser.\n", scheme, cfg.WebServerAddress)
+	fmt.Printf("Other API clients must present the token %s.\n\n", cfg.token)
+	if cfg.SinglePort {
+		web.Handle(API_PATH, browser)
+		web.Handle(REST_PATH, browser)
+		web.Handle(WS_PATH, browser)
+		log.Fatal("Web server error: ", listenAndServe(cfg.WebServerAddress, web, tlsConfig))
+	}
 	go func() {
-		http.ListenAndServe(WEB_SERVER_ADDRESS, http.FileServer(http.Dir("public")))
-		log.Fatal("Web server error: ", http.ListenAndServe(WEB_SERVER_ADDRESS, http.FileServer(http.Dir(HTML_DIR))))
+		log.Fatal("Web server error: ", listenAndServe(cfg.WebServerAddress, web, tlsConfig))
 	}()
-	browser := NewNamespaceBrowser(ctx)
-	log.Fatal("HTTP server error: ", http.ListenAndServe(SERVER_ADDRESS, browser))
+	log.Fatal("HTTP server error: ", listenAndServe(cfg.ServerAddress, browser, tlsConfig))
 }
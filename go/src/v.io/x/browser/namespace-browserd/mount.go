@@ -0,0 +1,84 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+)
+
+// mountParams are the params of mount.
+type mountParams struct {
+	Name   string `json:"name"`
+	Server string `json:"server"` // The object name or endpoint to mount.
+
+	// How long the mount lasts, e.g. "10m". Zero means it does not expire.
+	TTL duration `json:"ttl"`
+
+	// The flags of the mount entry.
+	ServesMountTable bool `json:"servesMountTable"`
+	IsLeaf           bool `json:"isLeaf"`
+	Replace          bool `json:"replace"` // Replaces the servers already mounted.
+}
+
+// unmountParams are the params of unmount. If Server is empty, every server
+// mounted at Name is unmounted.
+type unmountParams struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+}
+
+// mount mounts a server at a name.
+func (b *NamespaceBrowser) mount(ctx *context.T, params string) (mountReturn, error) {
+	var data mountParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return mountReturn{}, badParamsError{err}
+	}
+	if data.Name == "" || data.Server == "" {
+		return mountReturn{}, badParamsError{fmt.Errorf("name and server are required")}
+	}
+	fmt.Printf("Mount: %s at %s %s\n", data.Server, data.Name, params)
+
+	var opts []naming.NamespaceOpt
+	if data.ServesMountTable {
+		opts = append(opts, naming.ServesMountTable(true))
+	}
+	if data.IsLeaf {
+		opts = append(opts, naming.IsLeaf(true))
+	}
+	if data.Replace {
+		opts = append(opts, naming.ReplaceMount(true))
+	}
+	err := v23.GetNamespace(ctx).Mount(ctx, data.Name, data.Server, time.Duration(data.TTL), opts...)
+	b.cache.invalidate(data.Name)
+	if err != nil {
+		return mountReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	return mountReturn{}, nil
+}
+
+// unmount unmounts one server, or all of them, from a name.
+func (b *NamespaceBrowser) unmount(ctx *context.T, params string) (mountReturn, error) {
+	var data unmountParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return mountReturn{}, badParamsError{err}
+	}
+	if data.Name == "" {
+		return mountReturn{}, badParamsError{fmt.Errorf("name is required")}
+	}
+	fmt.Printf("Unmount: %q from %s\n", data.Server, data.Name)
+
+	err := v23.GetNamespace(ctx).Unmount(ctx, data.Name, data.Server)
+	b.cache.invalidate(data.Name)
+	if err != nil {
+		return mountReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	return mountReturn{}, nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+	"v.io/v23/verror"
+)
+
+// setPermissionsParams are the params of setPermissions.
+type setPermissionsParams struct {
+	Name        string             `json:"name"`
+	Permissions access.Permissions `json:"permissions"`
+
+	// The version the permissions were read at, as returned by the
+	// permissions request. If it is no longer the current version, the
+	// permissions are not set. It is required unless Force or DryRun is set.
+	Version string `json:"version"`
+
+	// If set, the permissions are set without a version, i.e. regardless of
+	// concurrent changes, which are lost.
+	Force bool `json:"force"`
+
+	// If set, the permissions are not changed. The response only tells how
+	// they would change.
+	DryRun bool `json:"dryRun"`
+}
+
+// permissionsChange is a tag that a blessing pattern gains or loses.
+type permissionsChange struct {
+	Pattern string `json:"pattern"`
+	Tag     string `json:"tag"`
+	Change  string `json:"change"` // "gains" or "loses".
+	List    string `json:"list"`   // The list that changed: "in" or "notIn".
+}
+
+// setPermissions sets the permissions of a name, if they are still at the
+// version they were read at, or regardless if forced, and returns the new
+// version. The changes from
+// the current permissions are returned too, and are all that is returned in
+// a dry run.
+func (b *NamespaceBrowser) setPermissions(ctx *context.T, params string) (setPermissionsReturn, error) {
+	var data setPermissionsParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return setPermissionsReturn{}, badParamsError{err}
+	}
+	if data.Name == "" || data.Permissions == nil {
+		return setPermissionsReturn{}, badParamsError{fmt.Errorf("name and permissions are required")}
+	}
+	if data.Version == "" && !data.Force && !data.DryRun {
+		return setPermissionsReturn{}, badParamsError{fmt.Errorf("version is required, unless force is set to overwrite concurrent changes")}
+	}
+	if data.Force {
+		data.Version = ""
+	}
+	fmt.Printf("Set permissions: %s %s\n", data.Name, params)
+
+	current, version, err := v23.GetNamespace(ctx).GetPermissions(ctx, data.Name)
+	if err != nil {
+		return setPermissionsReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	if data.Version != "" && data.Version != version {
+		err := verror.New(verror.ErrBadVersion, ctx, fmt.Sprintf("the permissions of %q were changed since version %s; they are now at version %s", data.Name, data.Version, version))
+		return setPermissionsReturn{Version: version, Err: fmt.Sprintf("%v", err)}, err
+	}
+	changes := diffPermissions(current, data.Permissions)
+	if data.DryRun {
+		return setPermissionsReturn{Version: version, Changes: changes}, nil
+	}
+
+	// The mount table also rejects the change if the version is stale, in
+	// case the permissions changed since they were read above.
+	err = v23.GetNamespace(ctx).SetPermissions(ctx, data.Name, data.Permissions, data.Version)
+	// What globs and resolves of the name return may have changed.
+	b.cache.invalidate(data.Name)
+	if err != nil {
+		return setPermissionsReturn{Changes: changes, Err: fmt.Sprintf("%v", err)}, err
+	}
+	_, version, err = v23.GetNamespace(ctx).GetPermissions(ctx, data.Name)
+	if err != nil {
+		return setPermissionsReturn{Changes: changes, Err: fmt.Sprintf("the permissions were set, but their new version could not be read: %v", err)}, err
+	}
+	return setPermissionsReturn{Version: version, Changes: changes}, nil
+}
+
+// diffPermissions returns the tags that blessing patterns gain and lose when
+// the permissions change from before to after, ordered by tag and pattern.
+// Adding a pattern to NotIn takes the tag from the blessings it matches.
+func diffPermissions(before, after access.Permissions) []permissionsChange {
+	changes := []permissionsChange{}
+	tags := map[string]bool{}
+	for tag := range before {
+		tags[tag] = true
+	}
+	for tag := range after {
+		tags[tag] = true
+	}
+	for _, tag := range sortedTags(tags) {
+		prev, next := before[tag], after[tag]
+		for _, p := range stringsMinus(inPatterns(next), inPatterns(prev)) {
+			changes = append(changes, permissionsChange{Pattern: p, Tag: tag, Change: "gains", List: "in"})
+		}
+		for _, p := range stringsMinus(inPatterns(prev), inPatterns(next)) {
+			changes = append(changes, permissionsChange{Pattern: p, Tag: tag, Change: "loses", List: "in"})
+		}
+		for _, p := range stringsMinus(next.NotIn, prev.NotIn) {
+			changes = append(changes, permissionsChange{Pattern: p, Tag: tag, Change: "loses", List: "notIn"})
+		}
+		for _, p := range stringsMinus(prev.NotIn, next.NotIn) {
+			changes = append(changes, permissionsChange{Pattern: p, Tag: tag, Change: "gains", List: "notIn"})
+		}
+	}
+	return changes
+}
+
+func inPatterns(acl access.AccessList) []string {
+	var patterns []string
+	for _, p := range acl.In {
+		patterns = append(patterns, string(p))
+	}
+	return patterns
+}
+
+// stringsMinus returns the sorted strings of a that are not in b.
+func stringsMinus(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, s := range b {
+		inB[s] = true
+	}
+	var ret []string
+	for _, s := range a {
+		if !inB[s] {
+			ret = append(ret, s)
+			inB[s] = true // Report duplicates once.
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func sortedTags(tags map[string]bool) []string {
+	var ret []string
+	for tag := range tags {
+		ret = append(ret, tag)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// The tags that mount tables check. They are always explained, along with any
+// other tags in the permissions.
+var mountTableTags = []string{"Admin", "Create", "Mount", "Read", "Resolve"}
+
+// explainAccessParams are the params of explainAccess. If no blessings are
+// given, the default blessings of the daemon's principal are used.
+type explainAccessParams struct {
+	Name      string   `json:"name"`
+	Blessings []string `json:"blessings"`
+}
+
+// tagAccess tells whether the blessings are granted a tag, and why.
+type tagAccess struct {
+	Tag       string           `json:"tag"`
+	Granted   bool             `json:"granted"`
+	Reason    string           `json:"reason"`
+	Blessings []blessingAccess `json:"blessings"`
+}
+
+// blessingAccess tells which pattern, if any, grants a tag to a blessing, or
+// denies it.
+type blessingAccess struct {
+	Blessing  string `json:"blessing"`
+	GrantedBy string `json:"grantedBy,omitempty"` // A pattern of In.
+	DeniedBy  string `json:"deniedBy,omitempty"`  // A pattern of NotIn.
+}
+
+// explainAccess evaluates the permissions of a name for some blessings, and
+// tells for each tag which patterns grant or deny it.
+func (b *NamespaceBrowser) explainAccess(ctx *context.T, params string) (explainAccessReturn, error) {
+	var data explainAccessParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return explainAccessReturn{}, badParamsError{err}
+	}
+	if data.Name == "" {
+		return explainAccessReturn{}, badParamsError{fmt.Errorf("name is required")}
+	}
+	blessings := data.Blessings
+	if len(blessings) == 0 {
+		principal := v23.GetPrincipal(ctx)
+		def, _ := principal.BlessingStore().Default()
+		blessings = security.BlessingNames(principal, def)
+	}
+
+	perms, _, err := v23.GetNamespace(ctx).GetPermissions(ctx, data.Name)
+	if err != nil {
+		return explainAccessReturn{Blessings: blessings, Err: fmt.Sprintf("%v", err)}, err
+	}
+	tags := map[string]bool{}
+	for _, tag := range mountTableTags {
+		tags[tag] = true
+	}
+	for tag := range perms {
+		tags[tag] = true
+	}
+	res := explainAccessReturn{Blessings: blessings}
+	for _, tag := range sortedTags(tags) {
+		res.Tags = append(res.Tags, explainTag(tag, perms, blessings))
+	}
+	return res, nil
+}
+
+// explainTag explains the access list of a tag the way AccessList.Includes
+// evaluates it: a blessing is granted the tag if it matches a pattern of In
+// and is not denied by a pattern of NotIn, i.e. is neither that pattern nor
+// an extension of it.
+func explainTag(tag string, perms access.Permissions, blessings []string) tagAccess {
+	res := tagAccess{Tag: tag, Blessings: []blessingAccess{}}
+	acl, ok := perms[tag]
+	if !ok {
+		res.Reason = "no access list for the tag"
+		return res
+	}
+	res.Granted = acl.Includes(blessings...)
+	var granted, denied []string
+	for _, blessing := range blessings {
+		ba := blessingAccess{Blessing: blessing}
+		for _, p := range acl.NotIn {
+			// Matched as AccessList.Includes does, so that the explanation
+			// agrees with Granted.
+			if security.BlessingPattern(p).MatchedBy(blessing) {
+				ba.DeniedBy = p
+				break
+			}
+		}
+		if ba.DeniedBy == "" {
+			for _, p := range acl.In {
+				if p.MatchedBy(blessing) {
+					ba.GrantedBy = string(p)
+					break
+				}
+			}
+		}
+		switch {
+		case ba.DeniedBy != "":
+			denied = append(denied, fmt.Sprintf("%s by NotIn %s", blessing, ba.DeniedBy))
+		case ba.GrantedBy != "":
+			granted = append(granted, fmt.Sprintf("%s by In %s", blessing, ba.GrantedBy))
+		}
+		res.Blessings = append(res.Blessings, ba)
+	}
+	switch {
+	case res.Granted:
+		res.Reason = "granted to " + strings.Join(granted, ", ")
+	case len(denied) > 0:
+		res.Reason = "denied to " + strings.Join(denied, ", ")
+	default:
+		res.Reason = "no pattern of In matches the blessings"
+	}
+	return res
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"v.io/v23/security"
+	"v.io/v23/security/access"
+)
+
+func TestDiffPermissions(t *testing.T) {
+	acl := func(in []security.BlessingPattern, notIn ...string) access.AccessList {
+		return access.AccessList{In: in, NotIn: notIn}
+	}
+	alice := []security.BlessingPattern{"dev.v.io:u:alice"}
+	aliceBob := []security.BlessingPattern{"dev.v.io:u:alice", "dev.v.io:u:bob"}
+	tests := []struct {
+		name          string
+		before, after access.Permissions
+		want          []permissionsChange
+	}{
+		{
+			name:   "unchanged",
+			before: access.Permissions{"Read": acl(alice)},
+			after:  access.Permissions{"Read": acl(alice)},
+		},
+		{
+			name: "both empty",
+		},
+		{
+			name:   "pattern added",
+			before: access.Permissions{"Read": acl(alice)},
+			after:  access.Permissions{"Read": acl(aliceBob)},
+			want:   []permissionsChange{{Pattern: "dev.v.io:u:bob", Tag: "Read", Change: "gains", List: "in"}},
+		},
+		{
+			name:   "pattern removed",
+			before: access.Permissions{"Read": acl(aliceBob)},
+			after:  access.Permissions{"Read": acl(alice)},
+			want:   []permissionsChange{{Pattern: "dev.v.io:u:bob", Tag: "Read", Change: "loses", List: "in"}},
+		},
+		{
+			name:   "tag added and removed",
+			before: access.Permissions{"Admin": acl(alice)},
+			after:  access.Permissions{"Resolve": acl(alice)},
+			want: []permissionsChange{
+				{Pattern: "dev.v.io:u:alice", Tag: "Admin", Change: "loses", List: "in"},
+				{Pattern: "dev.v.io:u:alice", Tag: "Resolve", Change: "gains", List: "in"},
+			},
+		},
+		{
+			name:   "notIn added",
+			before: access.Permissions{"Read": acl(alice)},
+			after:  access.Permissions{"Read": acl(alice, "dev.v.io:u:alice:phone")},
+			want:   []permissionsChange{{Pattern: "dev.v.io:u:alice:phone", Tag: "Read", Change: "loses", List: "notIn"}},
+		},
+		{
+			name:   "notIn removed",
+			before: access.Permissions{"Read": acl(alice, "dev.v.io:u:alice:phone")},
+			after:  access.Permissions{"Read": acl(alice)},
+			want:   []permissionsChange{{Pattern: "dev.v.io:u:alice:phone", Tag: "Read", Change: "gains", List: "notIn"}},
+		},
+		{
+			name:   "ordered by tag and pattern",
+			before: access.Permissions{},
+			after:  access.Permissions{"Write": acl(aliceBob), "Admin": acl(alice)},
+			want: []permissionsChange{
+				{Pattern: "dev.v.io:u:alice", Tag: "Admin", Change: "gains", List: "in"},
+				{Pattern: "dev.v.io:u:alice", Tag: "Write", Change: "gains", List: "in"},
+				{Pattern: "dev.v.io:u:bob", Tag: "Write", Change: "gains", List: "in"},
+			},
+		},
+		{
+			name:   "duplicate patterns",
+			before: access.Permissions{},
+			after:  access.Permissions{"Read": acl([]security.BlessingPattern{"dev.v.io:u:bob", "dev.v.io:u:bob"})},
+			want:   []permissionsChange{{Pattern: "dev.v.io:u:bob", Tag: "Read", Change: "gains", List: "in"}},
+		},
+	}
+	for _, test := range tests {
+		got := diffPermissions(test.before, test.after)
+		want := test.want
+		if want == nil {
+			want = []permissionsChange{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"v.io/v23/vdl"
+	"v.io/v23/vdlroot/signature"
+)
+
+// mutatingRequests change the namespace, permissions or credentials, call
+// methods that may change anything, or change the state of the daemon: record
+// writes files on its host, and clearCache drops the results shared by every
+// client. They are refused in read-only mode.
+var mutatingRequests = map[string]bool{
+	"deleteMountPoint":   true,
+	"deleteTree":         true,
+	"mount":              true,
+	"unmount":            true,
+	"setPermissions":     true,
+	"setDefaultBlessing": true,
+	"addRoot":            true,
+	"makeRPC":            true,
+	"streamRPC":          true,
+	"record":             true,
+	"clearCache":         true,
+}
+
+// policyError is returned for requests that the policy of namespace-browserd
+// refuses.
+type policyError struct {
+	error
+}
+
+// policyReturn describes the policy to the browser, so that it can hide what
+// would be refused.
+type policyReturn struct {
+	ReadOnly    bool     `json:"readOnly"`
+	AllowedTags []string `json:"allowedTags"`
+	Err         string   `json:"err"`
+}
+
+/* checkPolicy returns a policyError if a request may not be made:
+ *
+ * In read-only mode (config.ReadOnly), the mutatingRequests are refused, but
+ * for dry runs, which change nothing; a dry run of deleteTree then issues no
+ * token. RPCs are refused too, unless config.AllowedTags is set.
+ *
+ * If config.AllowedTags is set, RPCs are only made to methods with one of
+ * these tags; see checkMethodPolicy.
+ */
+func (b *NamespaceBrowser) checkPolicy(request, params string) error {
+	if !b.config.ReadOnly || !mutatingRequests[request] {
+		return nil
+	}
+	switch request {
+	case "makeRPC", "streamRPC":
+		if len(b.config.AllowedTags) > 0 {
+			return nil // Checked by checkMethodPolicy.
+		}
+	case "setPermissions", "deleteTree":
+		var data struct {
+			DryRun bool `json:"dryRun"`
+		}
+		if json.Unmarshal([]byte(params), &data) == nil && data.DryRun {
+			return nil
+		}
+	}
+	return policyError{fmt.Errorf("namespace-browserd is read-only: %s is not allowed", request)}
+}
+
+// checkMethodPolicy returns a policyError if config.AllowedTags is set and
+// method has none of them.
+func (b *NamespaceBrowser) checkMethodPolicy(method signature.Method) error {
+	if len(b.config.AllowedTags) == 0 {
+		return nil
+	}
+	for _, tag := range method.Tags {
+		for _, allowed := range b.config.AllowedTags {
+			if tagMatches(tag, allowed) {
+				return nil
+			}
+		}
+	}
+	return policyError{fmt.Errorf("method %s has none of the allowed tags %s", method.Name, strings.Join(b.config.AllowedTags, ", "))}
+}
+
+// tagMatches returns true if a method tag is the allowed one. Tags are
+// written as convertTags writes them, or, for string tags such as access.Read,
+// as the package name and value, with or without the package path.
+func tagMatches(tag *vdl.Value, allowed string) bool {
+	if tag.String() == allowed {
+		return true
+	}
+	if tag.Kind() != vdl.String {
+		return false
+	}
+	// The type name is like "v.io/v23/security/access.Tag".
+	name := tag.Type().Name()
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return false
+	}
+	pkgPath, value := name[:dot], tag.RawString()
+	return allowed == path.Base(pkgPath)+"."+value || allowed == pkgPath+"."+value
+}
+
+func (b *NamespaceBrowser) policy() policyReturn {
+	tags := []string(b.config.AllowedTags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return policyReturn{ReadOnly: b.config.ReadOnly, AllowedTags: tags}
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"v.io/v23/security/access"
+	"v.io/v23/vdl"
+	"v.io/v23/vdlroot/signature"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	readWrite := &config{}
+	readOnly := &config{ReadOnly: true}
+	tagged := &config{ReadOnly: true, AllowedTags: stringList{"access.Read"}}
+	tests := []struct {
+		c               *config
+		request, params string
+		refused         bool
+	}{
+		{readWrite, "mount", `{}`, false},
+		{readWrite, "deleteTree", `{"name":"a"}`, false},
+		{readWrite, "makeRPC", `{}`, false},
+		{readOnly, "glob", `{}`, false},
+		{readOnly, "getPermissions", `{}`, false},
+		{readOnly, "snapshot", `{}`, false},
+		{readOnly, "diff", `{}`, false},
+		{readOnly, "mount", `{}`, true},
+		{readOnly, "unmount", `{}`, true},
+		{readOnly, "deleteMountPoint", `{}`, true},
+		{readOnly, "setDefaultBlessing", `{}`, true},
+		{readOnly, "addRoot", `{}`, true},
+		{readOnly, "record", `{}`, true},
+		{readOnly, "clearCache", `{}`, true},
+		// Dry runs change nothing.
+		{readOnly, "setPermissions", `{"name":"a","dryRun":true}`, false},
+		{readOnly, "setPermissions", `{"name":"a"}`, true},
+		{readOnly, "setPermissions", `{"name":"a","dryRun":false}`, true},
+		{readOnly, "setPermissions", `not json`, true},
+		{readOnly, "deleteTree", `{"name":"a","dryRun":true}`, false},
+		{readOnly, "deleteTree", `{"name":"a","token":"t"}`, true},
+		// RPCs are refused, unless allowed by their tags.
+		{readOnly, "makeRPC", `{}`, true},
+		{readOnly, "streamRPC", `{}`, true},
+		{tagged, "makeRPC", `{}`, false},
+		{tagged, "streamRPC", `{}`, false},
+		{tagged, "mount", `{}`, true},
+	}
+	for _, test := range tests {
+		b := &NamespaceBrowser{config: test.c}
+		err := b.checkPolicy(test.request, test.params)
+		if _, ok := err.(policyError); ok != test.refused || (err != nil && !ok) {
+			t.Errorf("checkPolicy(%q, %q) with %+v: got %v, want refused %v", test.request, test.params, test.c, err, test.refused)
+		}
+	}
+}
+
+func TestCheckMethodPolicy(t *testing.T) {
+	read := signature.Method{Name: "Get", Tags: []*vdl.Value{vdl.ValueOf(access.Read)}}
+	admin := signature.Method{Name: "SetPermissions", Tags: []*vdl.Value{vdl.ValueOf(access.Admin)}}
+	untagged := signature.Method{Name: "Untagged"}
+	tests := []struct {
+		allowed stringList
+		method  signature.Method
+		refused bool
+	}{
+		{nil, read, false},
+		{nil, untagged, false},
+		{stringList{"access.Read"}, read, false},
+		{stringList{"access.Read"}, admin, true},
+		{stringList{"access.Read"}, untagged, true},
+		{stringList{"access.Read", "access.Admin"}, admin, false},
+	}
+	for _, test := range tests {
+		b := &NamespaceBrowser{config: &config{ReadOnly: true, AllowedTags: test.allowed}}
+		err := b.checkMethodPolicy(test.method)
+		if _, ok := err.(policyError); ok != test.refused || (err != nil && !ok) {
+			t.Errorf("checkMethodPolicy(%s) with tags %v: got %v, want refused %v", test.method.Name, test.allowed, err, test.refused)
+		}
+	}
+}
+
+func TestTagMatches(t *testing.T) {
+	tests := []struct {
+		tag     *vdl.Value
+		allowed string
+		want    bool
+	}{
+		{vdl.ValueOf(access.Read), "access.Read", true},
+		{vdl.ValueOf(access.Read), "v.io/v23/security/access.Read", true},
+		{vdl.ValueOf(access.Read), vdl.ValueOf(access.Read).String(), true},
+		{vdl.ValueOf(access.Read), "access.Write", false},
+		{vdl.ValueOf(access.Read), "Read", false},
+		{vdl.ValueOf(access.Read), "security.Read", false},
+		{vdl.ValueOf(access.Read), "security/access.Read", false},
+		{vdl.ValueOf(access.Write), "access.Read", false},
+		// Tags of unnamed types have no package.
+		{vdl.ValueOf("Read"), "access.Read", false},
+		{vdl.ValueOf(int32(1)), "access.Read", false},
+	}
+	for _, test := range tests {
+		if got := tagMatches(test.tag, test.allowed); got != test.want {
+			t.Errorf("tagMatches(%v, %q): got %v, want %v", test.tag, test.allowed, got, test.want)
+		}
+	}
+}
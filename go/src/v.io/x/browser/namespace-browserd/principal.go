@@ -0,0 +1,207 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/security"
+)
+
+// storedBlessing describes a blessing of the BlessingStore. PeerPattern is the
+// pattern of the peers it is presented to; it is empty for the default
+// blessing.
+type storedBlessing struct {
+	PeerPattern security.BlessingPattern `json:"peerPattern"`
+	Names       []string                 `json:"names"`
+	Chains      []blessingChain          `json:"chains"`
+
+	// When it expires, and how long until then, e.g. "71h59m". Both are
+	// omitted if it does not expire.
+	Expiry    *time.Time `json:"expiry,omitempty"`
+	ExpiresIn string     `json:"expiresIn,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// recognizedRoot is a public key recognized as the root of the blessings
+// matched by Pattern. PublicKey is its fingerprint, and DER its base64
+// encoding, as accepted by addRoot.
+type recognizedRoot struct {
+	Pattern   security.BlessingPattern `json:"pattern"`
+	PublicKey string                   `json:"publicKey"`
+	DER       string                   `json:"der"`
+}
+
+// setDefaultBlessingParams are the params of setDefaultBlessing. The default
+// becomes the stored blessing that has the given name.
+type setDefaultBlessingParams struct {
+	Blessing string `json:"blessing"`
+}
+
+// addRootParams are the params of addRoot.
+type addRootParams struct {
+	PublicKey string                   `json:"publicKey"` // Base64 of the DER encoding.
+	Pattern   security.BlessingPattern `json:"pattern"`
+}
+
+// principal describes the principal of the request's profile: its public key,
+// the blessings of its BlessingStore and the roots it recognizes.
+func (b *NamespaceBrowser) principal(ctx *context.T) (principalReturn, error) {
+	p := v23.GetPrincipal(ctx)
+	now := time.Now()
+	res := principalReturn{
+		Profile:   profileOf(ctx),
+		PublicKey: p.PublicKey().String(),
+		Blessings: []storedBlessing{},
+		Roots:     []recognizedRoot{},
+	}
+
+	def, _ := p.BlessingStore().Default()
+	res.Default = describeStored(p, "", def, now)
+	peers := p.BlessingStore().PeerBlessings()
+	var patterns []string
+	for pattern := range peers {
+		patterns = append(patterns, string(pattern))
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		pattern := security.BlessingPattern(pattern)
+		res.Blessings = append(res.Blessings, describeStored(p, pattern, peers[pattern], now))
+	}
+
+	roots := p.Roots().Dump()
+	patterns = nil
+	for pattern := range roots {
+		patterns = append(patterns, string(pattern))
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		for _, key := range roots[security.BlessingPattern(pattern)] {
+			root := recognizedRoot{Pattern: security.BlessingPattern(pattern), PublicKey: key.String()}
+			if der, err := key.MarshalBinary(); err == nil {
+				root.DER = base64.URLEncoding.EncodeToString(der)
+			}
+			res.Roots = append(res.Roots, root)
+		}
+	}
+	return res, nil
+}
+
+func describeStored(p security.Principal, pattern security.BlessingPattern, blessings security.Blessings, now time.Time) storedBlessing {
+	s := storedBlessing{
+		PeerPattern: pattern,
+		Names:       security.BlessingNames(p, blessings),
+		Chains:      describeBlessings(blessings),
+	}
+	if s.Names == nil {
+		s.Names = []string{}
+	}
+	sort.Strings(s.Names)
+	if expiry := blessings.Expiry(); !expiry.IsZero() {
+		s.Expiry = &expiry
+		s.ExpiresIn = expiry.Sub(now).String()
+		s.Expired = expiry.Before(now)
+	}
+	return s
+}
+
+// How long before its default blessing expires a profile is warned about.
+const expiryWarning = 24 * time.Hour
+
+// How often the default blessings are checked while serving.
+const expiryCheckInterval = time.Hour
+
+// warnExpiry logs the profiles whose default blessing has expired or expires
+// soon, since requests then fail without an obvious reason.
+func (b *NamespaceBrowser) warnExpiry() {
+	now := time.Now()
+	for name, p := range b.namespaces.profiles {
+		def, _ := v23.GetPrincipal(p.ctx).BlessingStore().Default()
+		expiry := def.Expiry()
+		switch {
+		case expiry.IsZero():
+		case expiry.Before(now):
+			log.Printf("The default blessing of profile %q expired at %v", name, expiry)
+		case expiry.Sub(now) < expiryWarning:
+			log.Printf("The default blessing of profile %q expires in %v", name, expiry.Sub(now))
+		}
+	}
+}
+
+// watchExpiry calls warnExpiry periodically, so that blessings that expire
+// while namespace-browserd is running are reported too.
+func (b *NamespaceBrowser) watchExpiry(interval time.Duration) {
+	for range time.Tick(interval) {
+		b.warnExpiry()
+	}
+}
+
+// setDefaultBlessing makes a stored blessing the default one of the request's
+// profile.
+func (b *NamespaceBrowser) setDefaultBlessing(ctx *context.T, params string) (principalReturn, error) {
+	var data setDefaultBlessingParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return principalReturn{}, badParamsError{err}
+	}
+	if data.Blessing == "" {
+		return principalReturn{}, badParamsError{fmt.Errorf("blessing is required")}
+	}
+
+	p := v23.GetPrincipal(ctx)
+	var found *security.Blessings
+	for _, blessings := range p.BlessingStore().PeerBlessings() {
+		for _, name := range security.BlessingNames(p, blessings) {
+			if name == data.Blessing {
+				blessings := blessings
+				found = &blessings
+			}
+		}
+	}
+	if found == nil {
+		return principalReturn{}, badParamsError{fmt.Errorf("no stored blessing is named %q", data.Blessing)}
+	}
+	fmt.Printf("Set default blessing of profile %q: %s\n", profileOf(ctx), data.Blessing)
+	if err := p.BlessingStore().SetDefault(*found); err != nil {
+		return principalReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	// What the profile may see has changed.
+	b.cache.invalidate("")
+	return b.principal(ctx)
+}
+
+// addRoot makes the principal of the request's profile recognize a public
+// key as the root of the blessings matched by a pattern.
+func (b *NamespaceBrowser) addRoot(ctx *context.T, params string) (principalReturn, error) {
+	var data addRootParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return principalReturn{}, badParamsError{err}
+	}
+	der, err := base64.URLEncoding.DecodeString(data.PublicKey)
+	if err != nil {
+		if der, err = base64.StdEncoding.DecodeString(data.PublicKey); err != nil {
+			return principalReturn{}, badParamsError{fmt.Errorf("publicKey is not base64: %v", err)}
+		}
+	}
+	if _, err := security.UnmarshalPublicKey(der); err != nil {
+		return principalReturn{}, badParamsError{fmt.Errorf("bad publicKey: %v", err)}
+	}
+	if data.Pattern == "" || !data.Pattern.IsValid() {
+		return principalReturn{}, badParamsError{fmt.Errorf("bad pattern %q", data.Pattern)}
+	}
+
+	fmt.Printf("Add root of profile %q: %s\n", profileOf(ctx), data.Pattern)
+	if err := v23.GetPrincipal(ctx).Roots().Add(der, data.Pattern); err != nil {
+		return principalReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	b.cache.invalidate("")
+	return b.principal(ctx)
+}
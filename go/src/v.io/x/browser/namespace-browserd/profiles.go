@@ -0,0 +1,131 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/security"
+	vsecurity "v.io/x/ref/lib/security"
+)
+
+// The profile of the credentials namespace-browserd was started with.
+const defaultProfile = "default"
+
+// A profile is a set of credentials that requests can act as, so that the
+// namespace can be seen as different principals, e.g. a service account,
+// without restarting the daemon.
+type profile struct {
+	name string
+	dir  string     // The credentials directory. Empty for the default profile.
+	ctx  *context.T // Carries the principal of the profile.
+}
+
+// profileKey is the key of the profile name in the contexts of requests.
+type profileKey struct{}
+
+// profileOf returns the name of the profile a context acts as.
+func profileOf(ctx *context.T) string {
+	if name, ok := ctx.Value(profileKey{}).(string); ok {
+		return name
+	}
+	return defaultProfile
+}
+
+// loadProfiles loads the credentials directories of config.Profiles.
+func (b *NamespaceBrowser) loadProfiles() error {
+	for name, dir := range b.config.Profiles {
+		if name == defaultProfile || name == "" {
+			return fmt.Errorf("%q cannot be the name of a profile", name)
+		}
+		principal, err := vsecurity.LoadPersistentPrincipal(dir, nil)
+		if err != nil {
+			return fmt.Errorf("cannot load the credentials of profile %q from %s: %v", name, dir, err)
+		}
+		ctx, err := v23.WithPrincipal(b.ctx, principal)
+		if err != nil {
+			return err
+		}
+		ctx = context.WithValue(ctx, profileKey{}, name)
+		b.namespaces.profiles[name] = &profile{name: name, dir: dir, ctx: ctx}
+		fmt.Printf("Loaded profile %q from %s\n", name, dir)
+	}
+	return nil
+}
+
+// profileInfo describes a profile to the browser.
+type profileInfo struct {
+	Name        string   `json:"name"`
+	Credentials string   `json:"credentials"` // The credentials directory.
+	PublicKey   string   `json:"publicKey"`
+	Blessings   []string `json:"blessings"` // The names of the default blessing.
+}
+
+// profiles lists the profiles that requests can act as, ordered by name with
+// the default profile first.
+func (b *NamespaceBrowser) profiles() []profileInfo {
+	var infos []profileInfo
+	for _, p := range b.namespaces.profiles {
+		principal := v23.GetPrincipal(p.ctx)
+		blessings, _ := principal.BlessingStore().Default()
+		names := security.BlessingNames(principal, blessings)
+		if names == nil {
+			names = []string{}
+		}
+		sort.Strings(names)
+		infos = append(infos, profileInfo{
+			Name:        p.name,
+			Credentials: p.dir,
+			PublicKey:   principal.PublicKey().String(),
+			Blessings:   names,
+		})
+	}
+	sort.Sort(byProfileName(infos))
+	return infos
+}
+
+type byProfileName []profileInfo
+
+func (s byProfileName) Len() int      { return len(s) }
+func (s byProfileName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byProfileName) Less(i, j int) bool {
+	if (s[i].Name == defaultProfile) != (s[j].Name == defaultProfile) {
+		return s[i].Name == defaultProfile
+	}
+	return s[i].Name < s[j].Name
+}
+
+// stringMap is a flag.Value of strings by name, written as
+// "name=value,...", e.g. "me=~/.v23,service=/etc/service/creds".
+type stringMap map[string]string
+
+func (m *stringMap) String() string {
+	var parts []string
+	for name, value := range *m {
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (m *stringMap) Set(s string) error {
+	values := stringMap{}
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%q is not name=value", part)
+		}
+		values[kv[0]] = kv[1]
+	}
+	*m = values
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"v.io/v23/context"
+)
+
+// Recordings are snapshots kept by namespace-browserd in
+// config.RecordingsDir, one JSON file per recording, so that the state of a
+// subtree can be compared over time.
+
+// recordingInfo describes a recording without its entries.
+type recordingInfo struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Taken   time.Time `json:"taken"`
+	Profile string    `json:"profile,omitempty"`
+	Roots   []string  `json:"roots,omitempty"`
+	Entries int       `json:"entries"`
+}
+
+// diffParams are the params of diff. If To is empty, the recording From is
+// compared with the live namespace.
+type diffParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+var recordingIDPattern = regexp.MustCompile(`^[0-9A-Za-z.-]+$`)
+
+// Flags of the CLI mode, which compares snapshot files and exits instead of
+// serving.
+var (
+	diffFrom   string
+	diffTo     string
+	diffFormat string
+)
+
+func init() {
+	flag.StringVar(&diffFrom, "diff-from", "", "if set, writes the changes since this JSON snapshot file and exits")
+	flag.StringVar(&diffTo, "diff-to", "", "JSON snapshot file to compare -diff-from with; the live namespace if empty")
+	flag.StringVar(&diffFormat, "diff-format", "text", "format of the changes: text or json")
+}
+
+// record takes a snapshot and keeps it as a recording.
+func (b *NamespaceBrowser) record(ctx *context.T, params snapshotParams, opts requestOptions) (recordingInfo, error) {
+	snap, err := b.takeSnapshot(ctx, params, opts)
+	if err != nil {
+		return recordingInfo{}, err
+	}
+	suffix, err := randomID()
+	if err != nil {
+		return recordingInfo{}, err
+	}
+	info := recordingInfo{
+		ID:      snap.Taken.Format("20060102T150405.000Z") + "-" + suffix[:8],
+		Name:    snap.Name,
+		Taken:   snap.Taken,
+		Profile: snap.Profile,
+		Roots:   snap.Roots,
+		Entries: len(snap.Entries),
+	}
+	if err := os.MkdirAll(b.config.RecordingsDir, 0700); err != nil {
+		return recordingInfo{}, err
+	}
+	f, err := os.Create(b.recordingPath(info.ID))
+	if err != nil {
+		return recordingInfo{}, err
+	}
+	if err := writeSnapshot(f, snap, "json"); err != nil {
+		f.Close()
+		return recordingInfo{}, err
+	}
+	return info, f.Close()
+}
+
+// recordings lists the recordings, oldest first.
+func (b *NamespaceBrowser) recordings() ([]recordingInfo, error) {
+	files, err := ioutil.ReadDir(b.config.RecordingsDir)
+	if os.IsNotExist(err) {
+		return []recordingInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	infos := []recordingInfo{}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(file.Name(), ".json")
+		snap, err := b.loadRecording(id)
+		if err != nil {
+			fmt.Printf("Skipping recording %s: %v\n", id, err)
+			continue
+		}
+		infos = append(infos, recordingInfo{ID: id, Name: snap.Name, Taken: snap.Taken, Profile: snap.Profile, Roots: snap.Roots, Entries: len(snap.Entries)})
+	}
+	sort.Sort(byTaken(infos))
+	return infos, nil
+}
+
+func (b *NamespaceBrowser) loadRecording(id string) (*snapshot, error) {
+	if !recordingIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("bad recording ID %q", id)
+	}
+	f, err := os.Open(b.recordingPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readSnapshot(f)
+}
+
+func (b *NamespaceBrowser) recordingPath(id string) string {
+	return filepath.Join(b.config.RecordingsDir, id+".json")
+}
+
+// diff compares two recordings, or a recording with the live namespace. The
+// live snapshot records what the recording does.
+func (b *NamespaceBrowser) diff(ctx *context.T, params diffParams) (*snapshotDiff, error) {
+	from, err := b.loadRecording(params.From)
+	if err != nil {
+		return nil, err
+	}
+	var to *snapshot
+	if params.To != "" {
+		to, err = b.loadRecording(params.To)
+	} else {
+		to, err = b.liveSnapshot(ctx, from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return diffSnapshots(from, to), nil
+}
+
+// liveSnapshot takes a snapshot of the subtree of from, recording what from
+// does, as the same profile and from the same namespace roots. It is bounded
+// by the deadline of ctx.
+func (b *NamespaceBrowser) liveSnapshot(ctx *context.T, from *snapshot) (*snapshot, error) {
+	ctx, cancel, err := b.withScope(ctx, from.Profile, from.Roots)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return b.takeSnapshot(ctx, snapshotParams{
+		Name:        from.Name,
+		Permissions: from.WithPermissions,
+		Signatures:  from.WithSignatures,
+	}, requestOptions{})
+}
+
+// diffMain is the CLI mode: it writes the changes between the snapshot files
+// given by the flags.
+func diffMain(browser *NamespaceBrowser) error {
+	read := func(path string) (*snapshot, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readSnapshot(f)
+	}
+	from, err := read(diffFrom)
+	if err != nil {
+		return err
+	}
+	var to *snapshot
+	if diffTo != "" {
+		to, err = read(diffTo)
+	} else {
+		ctx, cancel := browser.timed(browser.ctx, "snapshot", requestOptions{})
+		defer cancel()
+		to, err = browser.liveSnapshot(ctx, from)
+	}
+	if err != nil {
+		return err
+	}
+	diff := diffSnapshots(from, to)
+	switch diffFormat {
+	case "text":
+		return writeDiffText(os.Stdout, diff)
+	case "json":
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return fmt.Errorf("unknown diff format %q; use text or json", diffFormat)
+}
+
+type byTaken []recordingInfo
+
+func (s byTaken) Len() int           { return len(s) }
+func (s byTaken) Less(i, j int) bool { return s[i].Taken.Before(s[j].Taken) }
+func (s byTaken) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,419 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"v.io/v23/naming"
+	"v.io/v23/security"
+	"v.io/v23/verror"
+)
+
+// The REST API is served under this path, both on the API server and, in
+// single-port mode, on the web server.
+const REST_PATH = API_PATH + "/v1/"
+
+// restRoute describes how a path under REST_PATH maps to a request of the
+// EventSource protocol.
+type restRoute struct {
+	method  string // The accepted HTTP method.
+	request string // The request type passed to handle.
+	param   string // The query parameter holding a string param, if any.
+}
+
+/* restRoutes are the paths served under REST_PATH. They mirror the requests
+ * described at ServeHTTP, and respond with the same JSON values:
+ *
+ * GET    accountName
+ * GET    policy
+ * GET    profiles
+ * GET    principal
+ * POST   setDefaultBlessing with the setDefaultBlessing params as the JSON body
+ * POST   addRoot with the addRoot params as the JSON body
+ * GET    glob?pattern=<pattern>&<options>, with the options of globParams
+ *        => { entries: [], errors: [], truncated: <bool>, err: <err> }
+ * GET    permissions?name=<name>
+ * POST   setPermissions with the setPermissions params as the JSON body
+ * POST   explainAccess with the explainAccess params as the JSON body
+ * DELETE mountpoint?name=<name>
+ * DELETE tree?name=<name>&dryRun=true
+ *        => { results: [], token: <token>, err: <err> }
+ * DELETE tree?name=<name>&token=<token> => { results: [], err: <err> }
+ * POST   mount with the mount params as the JSON body
+ * POST   unmount with the unmount params as the JSON body
+ * GET    resolveToMounttable?name=<name>
+ * GET    objectAddresses?name=<name>
+ * GET    remoteBlessings?name=<name>
+ * GET    signature?name=<name>
+ * GET    snapshot?name=<name>&permissions=true&signatures=true&format=yaml
+ *        => the snapshot as JSON or YAML, or { err: <err> }
+ * POST   record with the snapshot params as the JSON body
+ * GET    recordings
+ * GET    diff?from=<recording id>&to=<recording id>
+ *        (without to, the recording is compared with the live namespace;
+ *        with format=text, only the text of the diff is returned)
+ * GET    cacheStats
+ * POST   clearCache with the clearCache params as the JSON body
+ * POST   rpc with the makeRPC params as the JSON body
+ * POST   streamSend with the streamSend params as the JSON body
+ * POST   streamCloseSend with the streamCloseSend params as the JSON body
+ *
+ * Every path also accepts the timeout, retries, profile and roots query
+ * parameters, and reports the profile and roots used in the X-Browser-Profile
+ * and X-Namespace-Roots headers.
+ *
+ * Streaming calls are started with the EventSource protocol or the WebSocket,
+ * but items can be sent to them here.
+ */
+var restRoutes = map[string]restRoute{
+	"accountName":         {"GET", "accountName", ""},
+	"policy":              {"GET", "policy", ""},
+	"profiles":            {"GET", "profiles", ""},
+	"principal":           {"GET", "principal", ""},
+	"setDefaultBlessing":  {"POST", "setDefaultBlessing", ""},
+	"addRoot":             {"POST", "addRoot", ""},
+	"permissions":         {"GET", "permissions", "name"},
+	"setPermissions":      {"POST", "setPermissions", ""},
+	"explainAccess":       {"POST", "explainAccess", ""},
+	"mountpoint":          {"DELETE", "deleteMountPoint", "name"},
+	"mount":               {"POST", "mount", ""},
+	"unmount":             {"POST", "unmount", ""},
+	"resolveToMounttable": {"GET", "resolveToMounttable", "name"},
+	"objectAddresses":     {"GET", "objectAddresses", "name"},
+	"remoteBlessings":     {"GET", "remoteBlessings", "name"},
+	"signature":           {"GET", "signature", "name"},
+	"record":              {"POST", "record", ""},
+	"recordings":          {"GET", "recordings", ""},
+	"cacheStats":          {"GET", "cacheStats", ""},
+	"clearCache":          {"POST", "clearCache", ""},
+	"rpc":                 {"POST", "makeRPC", ""},
+	"streamSend":          {"POST", "streamSend", ""},
+	"streamCloseSend":     {"POST", "streamCloseSend", ""},
+}
+
+// serveREST serves a request under REST_PATH with a plain JSON response and
+// an HTTP status code that reflects the outcome.
+func (b *NamespaceBrowser) serveREST(rw http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, REST_PATH)
+	if path == "glob" {
+		if req.Method != "GET" {
+			writeJSON(rw, http.StatusMethodNotAllowed, globListReturn{Err: "glob requires GET"})
+			return
+		}
+		b.serveRESTGlob(rw, req)
+		return
+	}
+	if path == "tree" {
+		if req.Method != "DELETE" {
+			writeJSON(rw, http.StatusMethodNotAllowed, deleteTreeListReturn{Err: "tree requires DELETE"})
+			return
+		}
+		b.serveRESTDeleteTree(rw, req)
+		return
+	}
+
+	if path == "snapshot" {
+		if req.Method != "GET" {
+			writeJSON(rw, http.StatusMethodNotAllowed, errorReturn{Err: "snapshot requires GET"})
+			return
+		}
+		b.serveRESTSnapshot(rw, req)
+		return
+	}
+
+	if path == "diff" {
+		if req.Method != "GET" {
+			writeJSON(rw, http.StatusMethodNotAllowed, diffReturn{Err: "diff requires GET"})
+			return
+		}
+		b.serveRESTDiff(rw, req)
+		return
+	}
+
+	route, ok := restRoutes[path]
+	if !ok {
+		writeJSON(rw, http.StatusNotFound, errorReturn{Err: fmt.Sprintf("unknown API path %q", req.URL.Path)})
+		return
+	}
+	if req.Method != route.method {
+		writeJSON(rw, http.StatusMethodNotAllowed, errorReturn{Err: fmt.Sprintf("%s requires %s", path, route.method)})
+		return
+	}
+
+	// Encode the params the same way the EventSource protocol does.
+	var params string
+	switch {
+	case route.param != "":
+		value := req.URL.Query().Get(route.param)
+		if value == "" {
+			writeJSON(rw, http.StatusBadRequest, errorReturn{Err: fmt.Sprintf("missing query parameter %q", route.param)})
+			return
+		}
+		encoded, _ := json.Marshal(value)
+		params = string(encoded)
+	case route.method == "POST":
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeJSON(rw, http.StatusBadRequest, errorReturn{Err: fmt.Sprintf("%v", err)})
+			return
+		}
+		params = string(body)
+	}
+
+	opts, err := requestOptionsFrom(req)
+	if err != nil {
+		writeJSON(rw, http.StatusBadRequest, errorReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	fmt.Println("REST request", route.request, "params", params)
+	ctx, cancel, err := b.requestContext(rw, req, opts)
+	if err != nil {
+		writeJSON(rw, httpStatus(err), errorReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer cancel()
+	ctx, cancelTimed := b.timed(ctx, route.request, opts)
+	defer cancelTimed()
+	res, err := b.handleWithRetries(ctx, route.request, params, opts)
+	if _, ok := err.(badParamsError); ok {
+		writeJSON(rw, http.StatusBadRequest, errorReturn{Err: fmt.Sprintf("bad params: %v", err)})
+		return
+	}
+	writeJSON(rw, httpStatus(err), res)
+}
+
+// serveRESTGlob collects the results of a glob into a single response.
+func (b *NamespaceBrowser) serveRESTGlob(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	params := globParams{
+		Pattern:         query.Get("pattern"),
+		LeafOnly:        query.Get("leafOnly") == "true",
+		MountTableOnly:  query.Get("mountTableOnly") == "true",
+		NameRegex:       query.Get("nameRegex"),
+		ServerBlessings: security.BlessingPattern(query.Get("serverBlessings")),
+	}
+	if params.Pattern == "" {
+		writeJSON(rw, http.StatusBadRequest, globListReturn{Err: `missing query parameter "pattern"`})
+		return
+	}
+	for name, n := range map[string]*int{"maxDepth": &params.MaxDepth, "maxResults": &params.MaxResults} {
+		if s := query.Get(name); s != "" {
+			var err error
+			if *n, err = strconv.Atoi(s); err != nil {
+				writeJSON(rw, http.StatusBadRequest, globListReturn{Err: fmt.Sprintf("bad %s %q", name, s)})
+				return
+			}
+		}
+	}
+
+	opts, err := requestOptionsFrom(req)
+	if err != nil {
+		writeJSON(rw, http.StatusBadRequest, globListReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	ctx, cancel, err := b.requestContext(rw, req, opts)
+	if err != nil {
+		writeJSON(rw, httpStatus(err), globListReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer cancel()
+	res := globListReturn{
+		Entries: []naming.MountEntry{},
+		Errors:  []naming.GlobError{},
+	}
+	ctx, cancelTimed := b.timed(ctx, "glob", opts)
+	defer cancelTimed()
+	err = b.cachedGlob(ctx, params, opts, func(r globReturn) {
+		switch {
+		case r.GlobRes != nil:
+			res.Entries = append(res.Entries, *r.GlobRes)
+		case r.GlobErr != nil:
+			res.Errors = append(res.Errors, *r.GlobErr)
+		case r.GlobEnd:
+			res.Truncated = r.Truncated
+		}
+	})
+	if _, ok := err.(badParamsError); ok {
+		writeJSON(rw, http.StatusBadRequest, globListReturn{Err: fmt.Sprintf("bad params: %v", err)})
+		return
+	}
+	if err != nil {
+		writeJSON(rw, httpStatus(err), globListReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	writeJSON(rw, http.StatusOK, res)
+}
+
+// serveRESTDeleteTree collects the results of a deleteTree into a single
+// response. Names that could not be deleted are listed with their errors.
+func (b *NamespaceBrowser) serveRESTDeleteTree(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	params, _ := json.Marshal(deleteTreeParams{
+		Name:   query.Get("name"),
+		DryRun: query.Get("dryRun") == "true",
+		Token:  query.Get("token"),
+	})
+	opts, err := requestOptionsFrom(req)
+	if err != nil {
+		writeJSON(rw, http.StatusBadRequest, deleteTreeListReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	ctx, cancel, err := b.requestContext(rw, req, opts)
+	if err != nil {
+		writeJSON(rw, httpStatus(err), deleteTreeListReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer cancel()
+	res := deleteTreeListReturn{Results: []deleteTreeReturn{}}
+	ctx, cancelTimed := b.timed(ctx, "deleteTree", opts)
+	defer cancelTimed()
+	err = b.deleteTree(ctx, string(params), opts, func(r deleteTreeReturn) {
+		if r.DeleteEnd {
+			res.Token, res.Err = r.Token, r.Err
+			return
+		}
+		res.Results = append(res.Results, r)
+	})
+	writeJSON(rw, httpStatus(err), res)
+}
+
+// serveRESTSnapshot responds with a snapshot of a subtree, in the format
+// given by the format query parameter.
+func (b *NamespaceBrowser) serveRESTSnapshot(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	params := snapshotParams{
+		Name:        query.Get("name"),
+		Permissions: query.Get("permissions") == "true",
+		Signatures:  query.Get("signatures") == "true",
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "yaml" {
+		writeJSON(rw, http.StatusBadRequest, errorReturn{Err: fmt.Sprintf("unknown format %q; use json or yaml", format)})
+		return
+	}
+	opts, err := requestOptionsFrom(req)
+	if err != nil {
+		writeJSON(rw, http.StatusBadRequest, errorReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	ctx, cancel, err := b.requestContext(rw, req, opts)
+	if err != nil {
+		writeJSON(rw, httpStatus(err), errorReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer cancel()
+	ctx, cancelTimed := b.timed(ctx, "snapshot", opts)
+	defer cancelTimed()
+	snap, err := b.takeSnapshot(ctx, params, opts)
+	if err != nil {
+		writeJSON(rw, httpStatus(err), errorReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	if format == "yaml" {
+		rw.Header().Set("Content-Type", "application/x-yaml")
+	} else {
+		rw.Header().Set("Content-Type", "application/json")
+	}
+	rw.Header().Set("Cache-Control", "no-cache")
+	if err := writeSnapshot(rw, snap, format); err != nil {
+		log.Printf("Failed to write snapshot: %v", err)
+	}
+}
+
+// serveRESTDiff compares two recordings, or a recording with the live
+// namespace. With format=text, the diff is returned as plain text.
+func (b *NamespaceBrowser) serveRESTDiff(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	params := diffParams{From: query.Get("from"), To: query.Get("to")}
+	if params.From == "" {
+		writeJSON(rw, http.StatusBadRequest, diffReturn{Err: `missing query parameter "from"`})
+		return
+	}
+	opts, err := requestOptionsFrom(req)
+	if err != nil {
+		writeJSON(rw, http.StatusBadRequest, diffReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	ctx, cancel, err := b.requestContext(rw, req, opts)
+	if err != nil {
+		writeJSON(rw, httpStatus(err), diffReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer cancel()
+	ctx, cancelTimed := b.timed(ctx, "diff", opts)
+	defer cancelTimed()
+	diff, err := b.diff(ctx, params)
+	if os.IsNotExist(err) {
+		writeJSON(rw, http.StatusNotFound, diffReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	if err != nil {
+		writeJSON(rw, httpStatus(err), diffReturn{Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	if query.Get("format") == "text" {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache")
+		writeDiffText(rw, diff)
+		return
+	}
+	var text bytes.Buffer
+	writeDiffText(&text, diff)
+	writeJSON(rw, http.StatusOK, diffReturn{Diff: diff, Text: text.String()})
+}
+
+// httpStatus returns the HTTP status code for the outcome of a request.
+func httpStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if _, ok := err.(badParamsError); ok {
+		return http.StatusBadRequest
+	}
+	if _, ok := err.(policyError); ok {
+		return http.StatusForbidden
+	}
+	if _, ok := err.(tokenError); ok {
+		return http.StatusForbidden
+	}
+	switch verror.ErrorID(err) {
+	case verror.ErrNoExist.ID:
+		return http.StatusNotFound
+	case verror.ErrNoAccess.ID, verror.ErrNoExistOrNoAccess.ID, verror.ErrNotTrusted.ID:
+		return http.StatusForbidden
+	case verror.ErrBadArg.ID:
+		return http.StatusBadRequest
+	case verror.ErrExist.ID, verror.ErrBadVersion.ID:
+		return http.StatusConflict
+	case verror.ErrTimeout.ID:
+		return http.StatusGatewayTimeout
+	case verror.ErrNoServers.ID:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(rw http.ResponseWriter, status int, data interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(data); err != nil {
+		log.Printf("Failed to encode data: %v, %v", data, err)
+	}
+}
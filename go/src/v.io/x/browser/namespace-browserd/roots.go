@@ -0,0 +1,150 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+)
+
+// namespaces holds a context for each credential profile and set of roots
+// that requests have asked for, so that they can browse other mount tables
+// than the ones namespace-browserd was started with, as other principals.
+// Each namespace keeps its own cache of resolutions, so it is reused by every
+// request for the same profile and roots. Once max sets of roots are kept,
+// the least recently used one is dropped for a new one; requests still using
+// it are not affected.
+type namespaces struct {
+	// The contexts of the profiles, by name. They carry the principal of the
+	// profile and the namespace of the default roots.
+	profiles map[string]*profile
+	max      int // How many root sets may be kept.
+
+	mu    sync.Mutex
+	byKey map[string]*rootSet // By profile and roots. GUARDED_BY(mu)
+}
+
+// rootSet is the context of a profile and set of roots.
+type rootSet struct {
+	ctx      *context.T
+	lastUsed time.Time
+}
+
+func newNamespaces(base *context.T, max int) *namespaces {
+	return &namespaces{
+		profiles: map[string]*profile{defaultProfile: {name: defaultProfile, ctx: base}},
+		max:      max,
+		byKey:    map[string]*rootSet{},
+	}
+}
+
+// context returns a context that carries the principal of a profile and the
+// namespace of the given roots. If profile is empty, the default profile is
+// used, and if roots is empty, the default roots.
+func (n *namespaces) context(profileName string, roots []string) (*context.T, error) {
+	if profileName == "" {
+		profileName = defaultProfile
+	}
+	p, ok := n.profiles[profileName]
+	if !ok {
+		return nil, badParamsError{fmt.Errorf("unknown profile %q", profileName)}
+	}
+	if len(roots) == 0 || sameRoots(roots, v23.GetNamespace(p.ctx).Roots()) {
+		return p.ctx, nil
+	}
+	for _, root := range roots {
+		if !naming.Rooted(root) {
+			return nil, badParamsError{fmt.Errorf("root %q is not a rooted name, e.g. /host:port", root)}
+		}
+	}
+	key := profileName + "|" + strings.Join(roots, ",")
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	if set, ok := n.byKey[key]; ok {
+		set.lastUsed = now
+		return set.ctx, nil
+	}
+	if n.max <= 0 {
+		return nil, fmt.Errorf("requests may not use other namespace roots")
+	}
+	ctx, _, err := v23.WithNewNamespace(p.ctx, roots...)
+	if err != nil {
+		return nil, err
+	}
+	if len(n.byKey) >= n.max {
+		n.evictOldest()
+	}
+	n.byKey[key] = &rootSet{ctx: ctx, lastUsed: now}
+	return ctx, nil
+}
+
+// evictOldest drops the least recently used set of roots. n.mu must be held.
+func (n *namespaces) evictOldest() {
+	var oldest string
+	for key, set := range n.byKey {
+		if oldest == "" || set.lastUsed.Before(n.byKey[oldest].lastUsed) {
+			oldest = key
+		}
+	}
+	delete(n.byKey, oldest)
+}
+
+// withScope returns a context that uses the principal of a profile and the
+// namespace of the given roots, and the deadline of parent. If either is
+// empty, that of parent is kept. If nothing changes, parent is returned.
+// Otherwise the context is not derived from parent, so it is not canceled
+// with it: the caller must call the returned cancel func once it is done, and
+// cancel it too if parent is canceled before then.
+func (b *NamespaceBrowser) withScope(parent *context.T, profileName string, roots []string) (*context.T, context.CancelFunc, error) {
+	if profileName == "" {
+		profileName = profileOf(parent)
+	}
+	if len(roots) == 0 {
+		roots = v23.GetNamespace(parent).Roots()
+	}
+	if profileName == profileOf(parent) && sameRoots(roots, v23.GetNamespace(parent).Roots()) {
+		return parent, func() {}, nil
+	}
+	base, err := b.namespaces.context(profileName, roots)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := parent.Deadline(); ok {
+		ctx, cancel := context.WithDeadline(base, deadline)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithCancel(base)
+	return ctx, cancel, nil
+}
+
+func sameRoots(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+// parseRoots reads a comma-separated list of roots.
+func parseRoots(s string) []string {
+	var roots []string
+	for _, root := range strings.Split(s, ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// reportScope tells an HTTP client which profile and roots its request used.
+func reportScope(rw http.ResponseWriter, ctx *context.T) {
+	rw.Header().Set("X-Browser-Profile", profileOf(ctx))
+	rw.Header().Set("X-Namespace-Roots", strings.Join(v23.GetNamespace(ctx).Roots(), ","))
+}
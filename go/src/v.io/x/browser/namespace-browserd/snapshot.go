@@ -0,0 +1,240 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/naming"
+	"v.io/v23/security/access"
+)
+
+// The version of the snapshot format. It changes when a snapshot written by
+// an older version can no longer be read the same way.
+const snapshotVersion = 1
+
+// snapshot is the state of a namespace subtree at some point in time.
+type snapshot struct {
+	Version int       `json:"version"`
+	Name    string    `json:"name"` // The root of the subtree.
+	Taken   time.Time `json:"taken"`
+	Profile string    `json:"profile,omitempty"` // The credential profile used.
+	Roots   []string  `json:"roots,omitempty"`   // The namespace roots used.
+
+	// Whether the permissions and signatures were recorded.
+	WithPermissions bool `json:"withPermissions"`
+	WithSignatures  bool `json:"withSignatures"`
+
+	Entries []snapshotEntry `json:"entries"` // Ordered by name.
+	Errors  []snapshotError `json:"errors"`  // The names that could not be globbed.
+}
+
+// snapshotEntry is a naming.MountEntry, along with the permissions and
+// signature at its name if they were asked for.
+type snapshotEntry struct {
+	Name             string           `json:"name"`
+	Servers          []snapshotServer `json:"servers"`
+	ServesMountTable bool             `json:"servesMountTable"`
+	IsLeaf           bool             `json:"isLeaf"`
+
+	Permissions        access.Permissions `json:"permissions,omitempty"`
+	PermissionsVersion string             `json:"permissionsVersion,omitempty"`
+	PermissionsErr     string             `json:"permissionsErr,omitempty"`
+
+	Signature    []pInterface `json:"signature,omitempty"`
+	SignatureErr string       `json:"signatureErr,omitempty"`
+}
+
+type snapshotServer struct {
+	Server   string    `json:"server"`
+	Deadline time.Time `json:"deadline"`
+}
+
+type snapshotError struct {
+	Name string `json:"name"`
+	Err  string `json:"err"`
+}
+
+// snapshotParams are the params of snapshot.
+type snapshotParams struct {
+	Name        string `json:"name"`
+	Permissions bool   `json:"permissions"` // Include the permissions of each name.
+	Signatures  bool   `json:"signatures"`  // Include the signatures of the servers.
+}
+
+// Flags of the CLI mode, which writes a snapshot and exits instead of serving.
+var (
+	snapshotName        string
+	snapshotOut         string
+	snapshotFormat      string
+	snapshotPermissions bool
+	snapshotSignatures  bool
+)
+
+func init() {
+	flag.StringVar(&snapshotName, "snapshot", "", "if set, writes a snapshot of the subtree at this name and exits")
+	flag.StringVar(&snapshotOut, "snapshot-out", "", "file to write the snapshot to; stdout if empty")
+	flag.StringVar(&snapshotFormat, "snapshot-format", "json", "format of the snapshot: json or yaml")
+	flag.BoolVar(&snapshotPermissions, "snapshot-permissions", false, "if true, the snapshot includes the permissions of each name")
+	flag.BoolVar(&snapshotSignatures, "snapshot-signatures", false, "if true, the snapshot includes the signatures of the servers")
+}
+
+/* takeSnapshot globs name/... and records every entry. Like the browser, it
+ * reads the permissions and signatures as the permissions and signature
+ * requests do. Signatures are read for the servers that are not mount tables.
+ *
+ * Names that cannot be globbed are recorded as errors. A permissions or
+ * signature request that fails is recorded in its entry. Only the glob
+ * itself failing, or ctx being done before every entry is recorded, fails
+ * the snapshot.
+ */
+func (b *NamespaceBrowser) takeSnapshot(ctx *context.T, params snapshotParams, opts requestOptions) (*snapshot, error) {
+	snap := &snapshot{
+		Version: snapshotVersion,
+		Name:    params.Name,
+		Taken:   time.Now().UTC(),
+		Profile: profileOf(ctx),
+		Roots:   v23.GetNamespace(ctx).Roots(),
+
+		WithPermissions: params.Permissions,
+		WithSignatures:  params.Signatures,
+
+		Entries: []snapshotEntry{},
+		Errors:  []snapshotError{},
+	}
+	var entries []naming.MountEntry
+	err := b.streamGlob(ctx, globParams{Pattern: naming.Join(params.Name, "...")}, opts, func(res globReturn) {
+		switch {
+		case res.GlobRes != nil:
+			entries = append(entries, *res.GlobRes)
+		case res.GlobErr != nil:
+			snap.Errors = append(snap.Errors, snapshotError{Name: res.GlobErr.Name, Err: fmt.Sprintf("%v", res.GlobErr.Error)})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// A name can be globbed more than once, e.g. both as a mount point and as
+	// an object of the server mounted there. The entry with servers is kept.
+	seen := map[string]int{}
+	for _, entry := range entries {
+		if i, ok := seen[entry.Name]; ok {
+			if len(entry.Servers) > 0 && len(snap.Entries[i].Servers) == 0 {
+				snap.Entries[i] = b.snapshotEntry(ctx, entry, params)
+			}
+			continue
+		}
+		seen[entry.Name] = len(snap.Entries)
+		snap.Entries = append(snap.Entries, b.snapshotEntry(ctx, entry, params))
+	}
+	// Past its deadline, the entries left would only record errors.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Sort(byEntryName(snap.Entries))
+	return snap, nil
+}
+
+// snapshotEntry records a mount entry.
+func (b *NamespaceBrowser) snapshotEntry(ctx *context.T, entry naming.MountEntry, params snapshotParams) snapshotEntry {
+	e := snapshotEntry{
+		Name:             entry.Name,
+		Servers:          []snapshotServer{},
+		ServesMountTable: entry.ServesMountTable,
+		IsLeaf:           entry.IsLeaf,
+	}
+	for _, server := range entry.Servers {
+		e.Servers = append(e.Servers, snapshotServer{Server: server.Server, Deadline: server.Deadline.Time.UTC()})
+	}
+	sort.Sort(byServer(e.Servers))
+
+	if params.Permissions {
+		perms, _ := b.getPermissions(ctx, entry.Name)
+		e.Permissions, e.PermissionsVersion, e.PermissionsErr = perms.Permissions, perms.Version, perms.Err
+	}
+	if params.Signatures && len(entry.Servers) > 0 && !entry.ServesMountTable {
+		sig, _ := b.getSignature(ctx, entry.Name)
+		e.Signature, e.SignatureErr = sig.Signature, sig.Err
+	}
+	return e
+}
+
+// readSnapshot reads a snapshot written as JSON.
+func readSnapshot(r io.Reader) (*snapshot, error) {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is not supported; expected %d", snap.Version, snapshotVersion)
+	}
+	return &snap, nil
+}
+
+// writeSnapshot writes a snapshot in the given format, json or yaml.
+func writeSnapshot(w io.Writer, snap *snapshot, format string) error {
+	switch format {
+	case "", "json":
+		data, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "yaml":
+		return writeYAML(w, snap)
+	}
+	return fmt.Errorf("unknown snapshot format %q; use json or yaml", format)
+}
+
+// snapshotMain is the CLI mode: it writes a snapshot as told by the flags.
+func snapshotMain(browser *NamespaceBrowser) error {
+	ctx, cancel := browser.timed(browser.ctx, "snapshot", requestOptions{})
+	defer cancel()
+	snap, err := browser.takeSnapshot(ctx, snapshotParams{
+		Name:        snapshotName,
+		Permissions: snapshotPermissions,
+		Signatures:  snapshotSignatures,
+	}, requestOptions{})
+	if err != nil {
+		return err
+	}
+	if snapshotOut == "" {
+		return writeSnapshot(os.Stdout, snap, snapshotFormat)
+	}
+	f, err := os.Create(snapshotOut)
+	if err != nil {
+		return err
+	}
+	if err := writeSnapshot(f, snap, snapshotFormat); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type byEntryName []snapshotEntry
+
+func (s byEntryName) Len() int           { return len(s) }
+func (s byEntryName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s byEntryName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type byServer []snapshotServer
+
+func (s byServer) Len() int           { return len(s) }
+func (s byServer) Less(i, j int) bool { return s[i].Server < s[j].Server }
+func (s byServer) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
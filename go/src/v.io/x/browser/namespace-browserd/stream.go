@@ -0,0 +1,245 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"v.io/v23"
+	"v.io/v23/context"
+	"v.io/v23/rpc"
+	"v.io/v23/vdl"
+)
+
+// rpcParams are the params of makeRPC and streamRPC.
+// The args are converted to typed values with the method's signature, which
+// also gives the number of out-args.
+type rpcParams struct {
+	Name       string            `json:"name"`
+	MethodName string            `json:"methodName"`
+	Args       []json.RawMessage `json:"args"`
+}
+
+// streamParams are the params of streamSend and streamCloseSend.
+type streamParams struct {
+	StreamID string          `json:"streamId"`
+	Item     json.RawMessage `json:"item"`
+}
+
+// rpcStream is a streaming call in progress. Items may be sent by several
+// requests at once, so Send, CloseSend and Finish are serialized by mu, and
+// nothing is sent once the call has finished.
+type rpcStream struct {
+	call   rpc.ClientCall
+	inType *vdl.Type // The type of the items sent to the server, if any.
+
+	mu       sync.Mutex
+	finished bool // GUARDED_BY(mu)
+}
+
+func (s *rpcStream) send(item interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return fmt.Errorf("the call has finished")
+	}
+	return s.call.Send(item)
+}
+
+func (s *rpcStream) closeSend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return fmt.Errorf("the call has finished")
+	}
+	return s.call.CloseSend()
+}
+
+func (s *rpcStream) finish(outptrs ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished = true
+	return s.call.Finish(outptrs...)
+}
+
+// rpcStreams holds the streaming calls in progress, so that the browser can
+// send to them with requests separate from the streamRPC request.
+type rpcStreams struct {
+	mu    sync.Mutex
+	calls map[string]*rpcStream // GUARDED_BY(mu)
+}
+
+func newRPCStreams() *rpcStreams {
+	return &rpcStreams{calls: map[string]*rpcStream{}}
+}
+
+func (s *rpcStreams) add(call *rpcStream) (string, error) {
+	// The ID is random so that it cannot be guessed by other clients.
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[id] = call
+	return id, nil
+}
+
+// randomID returns a random hex string that cannot be guessed.
+func randomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (s *rpcStreams) get(id string) (*rpcStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	call, ok := s.calls[id]
+	if !ok {
+		return nil, fmt.Errorf("no stream with ID %q", id)
+	}
+	return call, nil
+}
+
+func (s *rpcStreams) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.calls, id)
+}
+
+/* streamRPC makes a call to a method with streaming arguments and passes its
+ * responses to send:
+ *
+ * { streamId: <string> } once the call has started,
+ * { item: <item> } for each item the server sends,
+ * { response: []<outputs>, streamEnd: true } once the call has finished.
+ *
+ * If the call fails, err is set in the last response. While the call is in
+ * progress, items are sent to the server with streamSend requests, and the
+ * send side is closed with a streamCloseSend request.
+ *
+ * Streams can be long-lived, so unless a timeout is configured or requested
+ * for streamRPC, the call is bounded by the lifetime of ctx only.
+ */
+func (b *NamespaceBrowser) streamRPC(ctx *context.T, params string, send func(streamRPCReturn)) {
+	var data rpcParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("bad params: %v", err)})
+		return
+	}
+	if err := b.checkPolicy("streamRPC", params); err != nil {
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	fmt.Printf("Stream RPC: %s %s %s\n", data.Name, data.MethodName, params)
+
+	// Convert the args to the types in the method's signature.
+	method, inargs, err := b.typedInArgs(ctx, data)
+	if err != nil {
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	if err := b.checkMethodPolicy(method); err != nil {
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	call, err := v23.GetClient(ctx).StartCall(ctx, data.Name, data.MethodName, inargs)
+	if err != nil {
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	stream := &rpcStream{call: call}
+	if method.InStream != nil {
+		stream.inType = method.InStream.Type
+	}
+	id, err := b.streams.add(stream)
+	if err != nil {
+		call.Finish()
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+		return
+	}
+	defer b.streams.remove(id)
+	send(streamRPCReturn{StreamID: id})
+
+	// Forward the items from the server until it closes its stream.
+	for {
+		var item *vdl.Value
+		if err := call.Recv(&item); err != nil {
+			if err != io.EOF {
+				stream.finish()
+				send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+				return
+			}
+			break
+		}
+		res := convertResult(item)
+		send(streamRPCReturn{Item: &res})
+	}
+
+	outargs, outptrs := makeOutArgs(method)
+	if err := stream.finish(outptrs...); err != nil {
+		send(streamRPCReturn{StreamEnd: true, Err: fmt.Sprintf("%v", err)})
+		return
+	}
+
+	send(streamRPCReturn{Response: convertResults(outargs), StreamEnd: true})
+}
+
+// streamSend sends an item to the server of a streaming call.
+func (b *NamespaceBrowser) streamSend(params string) (streamSendReturn, error) {
+	var data streamParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return streamSendReturn{}, badParamsError{err}
+	}
+	stream, err := b.streams.get(data.StreamID)
+	if err != nil {
+		return streamSendReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	if stream.inType == nil {
+		err := fmt.Errorf("the method of stream %q takes no items", data.StreamID)
+		return streamSendReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+
+	// Convert the item to the type in the method's signature.
+	x, err := decodeJSON(data.Item)
+	if err != nil {
+		return streamSendReturn{}, badParamsError{err}
+	}
+	item, err := jsonToValue(stream.inType, x, "item")
+	if err != nil {
+		return streamSendReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	if err := stream.send(item); err != nil {
+		return streamSendReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	return streamSendReturn{}, nil
+}
+
+// streamCloseSend tells the server of a streaming call that no more items
+// will be sent.
+func (b *NamespaceBrowser) streamCloseSend(params string) (streamSendReturn, error) {
+	var data streamParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		return streamSendReturn{}, badParamsError{err}
+	}
+	stream, err := b.streams.get(data.StreamID)
+	if err != nil {
+		return streamSendReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	if err := stream.closeSend(); err != nil {
+		return streamSendReturn{Err: fmt.Sprintf("%v", err)}, err
+	}
+	return streamSendReturn{}, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/verror"
+)
+
+// requestOptions are accepted by every request type, besides its params.
+// They are given as the "timeout", "retries", "profile" and "roots" query
+// parameters of the EventSource protocol and the REST API, and as fields of
+// WebSocket messages.
+type requestOptions struct {
+	// How long the request may take. If zero, the default for the request
+	// type is used. It is kept within the configured minimum and maximum,
+	// and may not be negative.
+	Timeout duration `json:"timeout"`
+
+	// How many times to retry after a transient error. Zero, the default,
+	// means the request is tried once. At most MaxRetries are made, and only
+	// requests that change nothing are retried; see retriedRequests.
+	Retries int `json:"retries"`
+
+	// The namespace roots to use instead of the default ones, e.g. to browse
+	// another deployment's mount tables. See namespaces.
+	Roots []string `json:"roots"`
+
+	// The credential profile to act as, instead of the default one. See
+	// profiles.
+	Profile string `json:"profile"`
+}
+
+// retriedRequests are the requests that are retried after transient errors.
+// They only read, so trying them again is harmless, whereas a request that
+// changes something, e.g. makeRPC, might have taken effect before it failed.
+// The globs of glob, watch and dry runs of deleteTree are retried too.
+var retriedRequests = map[string]bool{
+	"accountName":         true,
+	"policy":              true,
+	"profiles":            true,
+	"principal":           true,
+	"resolveToMounttable": true,
+	"objectAddresses":     true,
+	"permissions":         true,
+	"explainAccess":       true,
+	"remoteBlessings":     true,
+	"signature":           true,
+	"snapshot":            true,
+	"recordings":          true,
+	"diff":                true,
+	"cacheStats":          true,
+}
+
+// requestOptionsFrom reads the options of an HTTP request.
+func requestOptionsFrom(req *http.Request) (requestOptions, error) {
+	var opts requestOptions
+	if s := req.FormValue("timeout"); s != "" {
+		if err := opts.Timeout.Set(s); err != nil {
+			return opts, fmt.Errorf("bad timeout %q: %v", s, err)
+		}
+		if opts.Timeout < 0 {
+			return opts, fmt.Errorf("bad timeout %q: must not be negative", s)
+		}
+	}
+	if s := req.FormValue("retries"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("bad retries %q: must be a number >= 0", s)
+		}
+		opts.Retries = n
+	}
+	opts.Roots = parseRoots(req.FormValue("roots"))
+	opts.Profile = req.FormValue("profile")
+	return opts, nil
+}
+
+// check returns an error if the options given in a WebSocket message are out
+// of range, as requestOptionsFrom does for HTTP requests.
+func (opts requestOptions) check() error {
+	if opts.Timeout < 0 {
+		return fmt.Errorf("bad timeout %q: must not be negative", opts.Timeout.String())
+	}
+	if opts.Retries < 0 {
+		return fmt.Errorf("bad retries %d: must be a number >= 0", opts.Retries)
+	}
+	return nil
+}
+
+// timeout returns how long a request of the given type may take. Zero means
+// it is not bounded.
+func (c *config) timeout(request string, opts requestOptions) time.Duration {
+	timeout := time.Duration(opts.Timeout)
+	if timeout == 0 {
+		if d, ok := c.Timeouts[request]; ok {
+			timeout = time.Duration(d)
+		} else if request == "streamRPC" || request == "watch" {
+			// Streams and watches can be long-lived, so by default they
+			// are only bounded by MaxTimeout, if it is set.
+			return time.Duration(c.MaxTimeout)
+		} else {
+			timeout = time.Duration(c.RPCTimeout)
+		}
+	}
+	if min := time.Duration(c.MinTimeout); min > 0 && timeout < min {
+		timeout = min
+	}
+	if max := time.Duration(c.MaxTimeout); max > 0 && timeout > max {
+		timeout = max
+	}
+	return timeout
+}
+
+// timed returns a context for a request of the given type, derived from
+// parent and bounded by the request's timeout. It is canceled at the latest
+// with parent; the returned cancel func must be called once the request is
+// done, to release it.
+func (b *NamespaceBrowser) timed(parent *context.T, request string, opts requestOptions) (*context.T, context.CancelFunc) {
+	timeout := b.config.timeout(request, opts)
+	if timeout == 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// withRetries calls op until it succeeds, fails with an error that is not
+// transient, or has been retried as many times as the options allow. Between
+// tries it waits with exponential backoff. It gives up once ctx is done.
+func (b *NamespaceBrowser) withRetries(ctx *context.T, opts requestOptions, op func() error) error {
+	retries := opts.Retries
+	if retries > b.config.MaxRetries {
+		retries = b.config.MaxRetries
+	}
+	backoff := time.Duration(b.config.RetryBackoff)
+	for try := 0; ; try++ {
+		err := op()
+		if err == nil || try >= retries || !isTransient(err) {
+			return err
+		}
+		fmt.Printf("Retrying in %v after transient error: %v\n", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient returns true if err is a Vanadium error that may go away if the
+// operation is tried again.
+func isTransient(err error) bool {
+	switch verror.Action(err) {
+	case verror.RetryConnection, verror.RetryRefetch, verror.RetryBackoff:
+		return true
+	}
+	return false
+}
+
+// durationMap is a flag.Value of durations by name, written as
+// "name=duration,...", e.g. "glob=1m,makeRPC=30s".
+type durationMap map[string]duration
+
+func (m *durationMap) String() string {
+	var parts []string
+	for name, d := range *m {
+		parts = append(parts, name+"="+d.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (m *durationMap) Set(s string) error {
+	values := durationMap{}
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%q is not name=duration", part)
+		}
+		var d duration
+		if err := d.Set(kv[1]); err != nil {
+			return err
+		}
+		values[kv[0]] = d
+	}
+	*m = values
+	return nil
+}
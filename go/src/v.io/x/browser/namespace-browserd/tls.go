@@ -0,0 +1,211 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the certificate files are checked for changes.
+const certReloadInterval = 10 * time.Second
+
+// How long a self-signed certificate is valid.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// useTLS returns true if the web and API servers are served over HTTPS.
+func (c *config) useTLS() bool {
+	return c.TLSCert != "" || c.TLSSelfSigned
+}
+
+// tlsConfig returns the TLS config of both servers: the certificate and key
+// of TLSCert and TLSKey, reloaded when they change, or a self-signed
+// certificate made at startup.
+func (c *config) tlsConfig() (*tls.Config, error) {
+	if c.TLSCert != "" {
+		if c.TLSKey == "" {
+			return nil, fmt.Errorf("-tls-key is required with -tls-cert")
+		}
+		r := &certReloader{certFile: c.TLSCert, keyFile: c.TLSKey}
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+		go r.watch(certReloadInterval)
+		return &tls.Config{GetCertificate: r.getCertificate}, nil
+	}
+	cert, err := selfSignedCertificate(c.WebServerAddress, c.ServerAddress)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Using a self-signed certificate with SHA-256 fingerprint %x\n", sha256.Sum256(cert.Certificate[0]))
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// How long a client may take to send the headers of a request, and how long
+// an idle keep-alive connection is kept. There is no write timeout, since
+// event streams and WebSockets are long-lived.
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
+// listenAndServe serves handler at addr, over HTTPS if tlsConfig is not nil.
+// Slow or idle clients are disconnected, so that they cannot hold on to
+// connections.
+func listenAndServe(addr string, handler http.Handler, tlsConfig *tls.Config) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+	ln, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ln)
+}
+
+// redirectToHTTPS redirects every HTTP request to the same path on the web
+// server over HTTPS.
+func (c *config) redirectToHTTPS(rw http.ResponseWriter, req *http.Request) {
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	_, port, err := net.SplitHostPort(c.WebServerAddress)
+	if err != nil {
+		http.Error(rw, "bad web server address", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(rw, req, "https://"+net.JoinHostPort(host, port)+req.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// certReloader serves a certificate and key from files, and reloads them when
+// they change, so that a renewed certificate is used without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate // GUARDED_BY(mu)
+	modTime time.Time        // Of the newer of the files. GUARDED_BY(mu)
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
+
+// modified returns the modification time of the newer of the files.
+func (r *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.modified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.modTime = &cert, modTime
+	return nil
+}
+
+// watch reloads the certificate whenever its files change. While they cannot
+// be loaded, e.g. because only one of them has been replaced yet, the
+// previous certificate is kept.
+func (r *certReloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		modTime, err := r.modified()
+		if err != nil {
+			log.Printf("Cannot check the TLS certificate: %v", err)
+			continue
+		}
+		r.mu.Lock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := r.load(); err != nil {
+			log.Printf("Cannot reload the TLS certificate, keeping the previous one: %v", err)
+			continue
+		}
+		fmt.Printf("Reloaded the TLS certificate from %s\n", r.certFile)
+	}
+}
+
+// selfSignedCertificate makes a certificate for localhost and the hosts of
+// the given addresses.
+func selfSignedCertificate(addrs ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"namespace-browserd"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || host == "" || host == "localhost" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -26,13 +26,60 @@ type globReturn struct {
 	GlobRes *naming.MountEntry `json:"globRes"`
 	GlobErr *naming.GlobError  `json:"globErr"`
 	GlobEnd bool               `json:"globEnd"`
-	Err     string             `json:"err"`
+
+	// Set on the globEnd response if results were left out because there
+	// were more than maxResults.
+	Truncated bool   `json:"truncated"`
+	Err       string `json:"err"`
+}
+
+// globListReturn is the response to a glob made through the REST API, which
+// collects the whole stream.
+type globListReturn struct {
+	Entries   []naming.MountEntry `json:"entries"`
+	Errors    []naming.GlobError  `json:"errors"`
+	Truncated bool                `json:"truncated"`
+	Err       string              `json:"err"`
 }
 
 type deleteReturn struct {
 	Err string `json:"err"`
 }
 
+type watchReturn struct {
+	Event    string             `json:"event"` // "added", "removed" or "changed".
+	Entry    *naming.MountEntry `json:"entry"`
+	Synced   bool               `json:"synced"`
+	WatchEnd bool               `json:"watchEnd"`
+	Err      string             `json:"err"`
+}
+
+type deleteTreeReturn struct {
+	Name      string `json:"name"`
+	Deleted   bool   `json:"deleted"`
+	Token     string `json:"token"`
+	DeleteEnd bool   `json:"deleteEnd"`
+	Err       string `json:"err"`
+}
+
+// deleteTreeListReturn is the response to a deleteTree made through the REST
+// API, which collects the whole stream.
+type deleteTreeListReturn struct {
+	Results []deleteTreeReturn `json:"results"`
+	Token   string             `json:"token"`
+	Err     string             `json:"err"`
+}
+
+type mountReturn struct {
+	Err string `json:"err"`
+}
+
+type explainAccessReturn struct {
+	Blessings []string    `json:"blessings"` // The blessings evaluated.
+	Tags      []tagAccess `json:"tags"`
+	Err       string      `json:"err"`
+}
+
 type addressesReturn struct {
 	Addresses []string `json:"addresses"`
 	Err       string   `json:"err"`
@@ -40,12 +87,22 @@ type addressesReturn struct {
 
 type permissionsReturn struct {
 	Permissions access.Permissions `json:"permissions"`
+	Version     string             `json:"version"`
 	Err         string             `json:"err"`
 }
 
+type setPermissionsReturn struct {
+	Version string              `json:"version"`
+	Changes []permissionsChange `json:"changes"`
+	Err     string              `json:"err"`
+}
+
 type blessingsReturn struct {
-	Blessings []string `json:"blessings"`
-	Err       string   `json:"err"`
+	Blessings []string           `json:"blessings"` // The names accepted by the client.
+	PublicKey string             `json:"publicKey"`
+	Chains    []blessingChain    `json:"chains"`
+	Rejected  []rejectedBlessing `json:"rejected"`
+	Err       string             `json:"err"`
 }
 
 type signatureReturn struct {
@@ -54,8 +111,65 @@ type signatureReturn struct {
 }
 
 type makeRPCReturn struct {
-	Response []string `json:"response"`
-	Err      string   `json:"err"`
+	Response []pResult `json:"response"`
+	Err      string    `json:"err"`
+}
+
+type streamRPCReturn struct {
+	StreamID  string    `json:"streamId"`
+	Item      *pResult  `json:"item"`
+	Response  []pResult `json:"response"`
+	StreamEnd bool      `json:"streamEnd"`
+	Err       string    `json:"err"`
+}
+
+type snapshotReturn struct {
+	Snapshot *snapshot `json:"snapshot"`
+	Err      string    `json:"err"`
+}
+
+type recordReturn struct {
+	Recording *recordingInfo `json:"recording"`
+	Err       string         `json:"err"`
+}
+
+type recordingsReturn struct {
+	Recordings []recordingInfo `json:"recordings"`
+	Err        string          `json:"err"`
+}
+
+type diffReturn struct {
+	Diff *snapshotDiff `json:"diff"`
+	Text string        `json:"text"` // The diff for people to read.
+	Err  string        `json:"err"`
+}
+
+type profilesReturn struct {
+	Profiles []profileInfo `json:"profiles"`
+	Err      string        `json:"err"`
+}
+
+type principalReturn struct {
+	Profile   string           `json:"profile"`
+	PublicKey string           `json:"publicKey"`
+	Default   storedBlessing   `json:"default"`
+	Blessings []storedBlessing `json:"blessings"` // By peer pattern.
+	Roots     []recognizedRoot `json:"roots"`
+	Err       string           `json:"err"`
+}
+
+type cacheStatsReturn struct {
+	Stats cacheStats `json:"stats"`
+	Err   string     `json:"err"`
+}
+
+type streamSendReturn struct {
+	Err string `json:"err"`
+}
+
+// errorReturn is the response to a REST request that could not be performed.
+type errorReturn struct {
+	Err string `json:"err"`
 }
 
 // pInterface describes the signature of an interface.
@@ -95,6 +209,31 @@ type pArg struct {
 	Type string `json:"type"` // Type of the argument.
 }
 
+// pResult is a result of an RPC as JSON, along with its type.
+// See value.go for how values are encoded.
+type pResult struct {
+	Value interface{} `json:"value"`
+	Type  *pType      `json:"type"`
+}
+
+// pType describes a VDL type.
+type pType struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	String string   `json:"string"`           // The type in VDL syntax.
+	Elem   *pType   `json:"elem,omitempty"`   // Optional, array, list and map
+	Key    *pType   `json:"key,omitempty"`    // Set and map
+	Len    int      `json:"len,omitempty"`    // Array
+	Labels []string `json:"labels,omitempty"` // Enum
+	Fields []pField `json:"fields,omitempty"` // Struct and union
+}
+
+// pField describes a field of a struct or union type.
+type pField struct {
+	Name string `json:"name"`
+	Type *pType `json:"type"`
+}
+
 // Helper method to convert []signature.Interface to the parallel data
 // structure, []pInterface.
 func convertSignature(sig []signature.Interface) []pInterface {
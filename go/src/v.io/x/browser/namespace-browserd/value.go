@@ -0,0 +1,183 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+/*
+ * Converts the *vdl.Value results of RPCs to JSON for the browser. Values are
+ * encoded the same way convert.go reads arguments, so a result can be given
+ * back as an argument of another call:
+ *   bool, string: as is
+ *   byte, uint*, int*: a number, or a string if JS cannot hold it exactly
+ *   float*: a number, or a string for NaN and infinities
+ *   enum: the label
+ *   typeobject: the type as a string
+ *   []byte and [N]byte: a base64 string
+ *   array, list, set: an array
+ *   map: an object if the keys are strings, numbers, bools or enums, and an
+ *        array of { key: <key>, value: <value> } otherwise
+ *   struct: an object with every field
+ *   union: an object with the one field that is set
+ *   optional, any: null, or the value held
+ */
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+
+	"v.io/v23/vdl"
+)
+
+// The largest integer that JS numbers can hold exactly.
+const maxSafeInteger = 1<<53 - 1
+
+// convertResult returns the JSON form of a result, with its type.
+func convertResult(v *vdl.Value) pResult {
+	if v == nil {
+		return pResult{}
+	}
+	return pResult{
+		Value: valueToJSON(v),
+		Type:  convertType(v.Type(), map[*vdl.Type]bool{}),
+	}
+}
+
+func convertResults(values []*vdl.Value) []pResult {
+	ret := []pResult{}
+	for _, v := range values {
+		ret = append(ret, convertResult(v))
+	}
+	return ret
+}
+
+// valueToJSON returns a value that json.Marshal encodes as described above.
+func valueToJSON(v *vdl.Value) interface{} {
+	switch v.Kind() {
+	case vdl.Any, vdl.Optional:
+		if v.IsNil() {
+			return nil
+		}
+		return valueToJSON(v.Elem())
+	case vdl.Bool:
+		return v.Bool()
+	case vdl.Byte, vdl.Uint16, vdl.Uint32, vdl.Uint64:
+		if u := v.Uint(); u > maxSafeInteger {
+			return strconv.FormatUint(u, 10)
+		}
+		return v.Uint()
+	case vdl.Int8, vdl.Int16, vdl.Int32, vdl.Int64:
+		if i := v.Int(); i > maxSafeInteger || i < -maxSafeInteger {
+			return strconv.FormatInt(i, 10)
+		}
+		return v.Int()
+	case vdl.Float32, vdl.Float64:
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return v.Float()
+	case vdl.String:
+		return v.RawString()
+	case vdl.Enum:
+		return v.EnumLabel()
+	case vdl.TypeObject:
+		return v.TypeObject().String()
+	case vdl.Array, vdl.List:
+		if v.Type().Elem().Kind() == vdl.Byte {
+			return base64.StdEncoding.EncodeToString(v.Bytes())
+		}
+		ret := make([]interface{}, v.Len())
+		for i := range ret {
+			ret[i] = valueToJSON(v.Index(i))
+		}
+		return ret
+	case vdl.Set:
+		ret := []interface{}{}
+		for _, key := range v.Keys() {
+			ret = append(ret, valueToJSON(key))
+		}
+		return ret
+	case vdl.Map:
+		if isStringableKey(v.Type().Key()) {
+			ret := map[string]interface{}{}
+			for _, key := range v.Keys() {
+				ret[fmt.Sprint(valueToJSON(key))] = valueToJSON(v.MapIndex(key))
+			}
+			return ret
+		}
+		ret := []interface{}{}
+		for _, key := range v.Keys() {
+			ret = append(ret, map[string]interface{}{
+				"key":   valueToJSON(key),
+				"value": valueToJSON(v.MapIndex(key)),
+			})
+		}
+		return ret
+	case vdl.Struct:
+		ret := map[string]interface{}{}
+		for i := 0; i < v.Type().NumField(); i++ {
+			ret[v.Type().Field(i).Name] = valueToJSON(v.StructField(i))
+		}
+		return ret
+	case vdl.Union:
+		index, field := v.UnionField()
+		return map[string]interface{}{
+			v.Type().Field(index).Name: valueToJSON(field),
+		}
+	}
+	// Kinds without a JSON form are given as a VDL literal.
+	return v.String()
+}
+
+// isStringableKey returns true if map keys of type t can be JSON object keys.
+func isStringableKey(t *vdl.Type) bool {
+	switch t.Kind() {
+	case vdl.Bool, vdl.Byte, vdl.Uint16, vdl.Uint32, vdl.Uint64, vdl.Int8, vdl.Int16, vdl.Int32, vdl.Int64, vdl.Float32, vdl.Float64, vdl.String, vdl.Enum:
+		return true
+	}
+	return false
+}
+
+// convertType returns the descriptor of t. Named types that are already being
+// described further up, i.e. recursive types, are given by name only.
+func convertType(t *vdl.Type, seen map[*vdl.Type]bool) *pType {
+	ret := &pType{
+		Kind:   t.Kind().String(),
+		Name:   t.Name(),
+		String: t.String(),
+	}
+	if t.Name() != "" {
+		if seen[t] {
+			return ret
+		}
+		seen[t] = true
+		defer delete(seen, t)
+	}
+	switch t.Kind() {
+	case vdl.Optional, vdl.Array, vdl.List:
+		ret.Elem = convertType(t.Elem(), seen)
+		if t.Kind() == vdl.Array {
+			ret.Len = t.Len()
+		}
+	case vdl.Set:
+		ret.Key = convertType(t.Key(), seen)
+	case vdl.Map:
+		ret.Key = convertType(t.Key(), seen)
+		ret.Elem = convertType(t.Elem(), seen)
+	case vdl.Enum:
+		for i := 0; i < t.NumEnumLabel(); i++ {
+			ret.Labels = append(ret.Labels, t.EnumLabel(i))
+		}
+	case vdl.Struct, vdl.Union:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			ret.Fields = append(ret.Fields, pField{
+				Name: f.Name,
+				Type: convertType(f.Type, seen),
+			})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"v.io/v23/vdl"
+)
+
+func TestValueToJSON(t *testing.T) {
+	pointKeyed := vdl.ZeroValue(vdl.MapType(pointType, vdl.StringType))
+	pointKeyed.AssignMapIndex(pointValue(1, 2), vdl.ValueOf("a"))
+
+	tests := []struct {
+		v    *vdl.Value
+		want string
+	}{
+		{vdl.ValueOf(true), `true`},
+		{vdl.ValueOf("a"), `"a"`},
+		{vdl.ValueOf(byte(7)), `7`},
+		{vdl.ValueOf(uint32(4294967295)), `4294967295`},
+		{vdl.ValueOf(int32(-5)), `-5`},
+		// Integers that JS numbers cannot hold exactly are strings.
+		{vdl.ValueOf(uint64(maxSafeInteger)), `9007199254740991`},
+		{vdl.ValueOf(uint64(maxSafeInteger + 1)), `"9007199254740992"`},
+		{vdl.ValueOf(uint64(math.MaxUint64)), `"18446744073709551615"`},
+		{vdl.ValueOf(int64(-maxSafeInteger)), `-9007199254740991`},
+		{vdl.ValueOf(int64(-maxSafeInteger - 1)), `"-9007199254740992"`},
+		{vdl.ValueOf(1.5), `1.5`},
+		{vdl.ValueOf(math.NaN()), `"NaN"`},
+		{vdl.ValueOf(math.Inf(-1)), `"-Inf"`},
+		{vdl.ValueOf([]byte("hi")), `"aGk="`},
+		{vdl.ValueOf([2]byte{'h', 'i'}), `"aGk="`},
+		{vdl.ValueOf([]uint32{1, 2}), `[1,2]`},
+		{vdl.ValueOf([]uint32{}), `[]`},
+		{vdl.ValueOf([2]int32{1, 2}), `[1,2]`},
+		{vdl.ValueOf(map[string]struct{}{"a": {}}), `["a"]`},
+		{vdl.ValueOf(map[string]uint64{"a": 1, "b": 2}), `{"a":1,"b":2}`},
+		{vdl.ValueOf(map[uint32]string{1: "a"}), `{"1":"a"}`},
+		{vdl.ValueOf(map[string]uint64{}), `{}`},
+		// Keys that cannot be object keys are given with their values.
+		{pointKeyed, `[{"key":{"X":1,"Y":2},"value":"a"}]`},
+		{pointValue(1, 2), `{"X":1,"Y":2}`},
+		{pointValue(0, 0), `{"X":0,"Y":0}`},
+		{colorValue("Green"), `"Green"`},
+		{shapeValue(1, vdl.ValueOf("square")), `{"Name":"square"}`},
+		{shapeValue(0, vdl.ValueOf(2.5)), `{"Radius":2.5}`},
+		{vdl.ZeroValue(vdl.OptionalType(pointType)), `null`},
+		{vdl.OptionalValue(pointValue(1, 0)), `{"X":1,"Y":0}`},
+		{vdl.ZeroValue(vdl.AnyType), `null`},
+		{vdl.ZeroValue(vdl.TypeObjectType).AssignTypeObject(vdl.ListType(vdl.Uint32Type)), `"[]uint32"`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(valueToJSON(test.v))
+		if err != nil {
+			t.Errorf("valueToJSON(%v) cannot be encoded: %v", test.v, err)
+			continue
+		}
+		if got := string(data); got != test.want {
+			t.Errorf("valueToJSON(%v): got %s, want %s", test.v, got, test.want)
+		}
+	}
+}
+
+// A result can be given back as an argument of the same type.
+func TestValueToJSONRoundTrip(t *testing.T) {
+	values := []*vdl.Value{
+		vdl.ValueOf(uint32(7)),
+		vdl.ValueOf(uint64(math.MaxUint64)),
+		vdl.ValueOf(int64(math.MinInt64)),
+		vdl.ValueOf(math.Inf(1)),
+		vdl.ValueOf([]byte("hi")),
+		vdl.ValueOf([2]byte{'h', 'i'}),
+		vdl.ValueOf([]uint32{1, 2}),
+		vdl.ValueOf(map[string]struct{}{"a": {}, "b": {}}),
+		vdl.ValueOf(map[uint32]string{1: "a", 2: "b"}),
+		vdl.ValueOf(map[bool]string{true: "a"}),
+		pointValue(1, 2),
+		colorValue("Green"),
+		shapeValue(1, vdl.ValueOf("square")),
+		vdl.ZeroValue(vdl.OptionalType(pointType)),
+		vdl.OptionalValue(pointValue(1, 0)),
+	}
+	for _, v := range values {
+		data, err := json.Marshal(valueToJSON(v))
+		if err != nil {
+			t.Errorf("valueToJSON(%v) cannot be encoded: %v", v, err)
+			continue
+		}
+		got, err := jsonToValue(v.Type(), mustDecodeJSON(t, string(data)), "arg")
+		if err != nil {
+			t.Errorf("%v, as %s, cannot be read back: %v", v, data, err)
+			continue
+		}
+		if !vdl.EqualValue(got, v) {
+			t.Errorf("%v, as %s, is read back as %v", v, data, got)
+		}
+	}
+}
+
+func TestConvertType(t *testing.T) {
+	field := func(name string, t *pType) pField {
+		return pField{Name: name, Type: t}
+	}
+	int32Type := &pType{Kind: "int32"}
+	tests := []struct {
+		t    *vdl.Type
+		want *pType
+	}{
+		{vdl.Uint32Type, &pType{Kind: "uint32"}},
+		{vdl.ListType(vdl.Uint32Type), &pType{Kind: "list", Elem: &pType{Kind: "uint32"}}},
+		{vdl.ArrayType(3, vdl.ByteType), &pType{Kind: "array", Len: 3, Elem: &pType{Kind: "byte"}}},
+		{vdl.SetType(vdl.StringType), &pType{Kind: "set", Key: &pType{Kind: "string"}}},
+		{vdl.MapType(vdl.StringType, vdl.Int32Type), &pType{Kind: "map", Key: &pType{Kind: "string"}, Elem: int32Type}},
+		{pointType, &pType{Kind: "struct", Name: "test.Point", Fields: []pField{field("X", int32Type), field("Y", int32Type)}}},
+		{colorType, &pType{Kind: "enum", Name: "test.Color", Labels: []string{"Red", "Green"}}},
+		{shapeType, &pType{Kind: "union", Name: "test.Shape", Fields: []pField{field("Radius", &pType{Kind: "float64"}), field("Name", &pType{Kind: "string"})}}},
+		{vdl.OptionalType(pointType), &pType{Kind: "optional", Elem: &pType{Kind: "struct", Name: "test.Point", Fields: []pField{field("X", int32Type), field("Y", int32Type)}}}},
+		{vdl.AnyType, &pType{Kind: "any"}},
+	}
+	for _, test := range tests {
+		got := convertType(test.t, map[*vdl.Type]bool{})
+		if got.String != test.t.String() {
+			t.Errorf("convertType(%v): got string %q", test.t, got.String)
+		}
+		clearTypeStrings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(test.want)
+			t.Errorf("convertType(%v): got %s, want %s", test.t, gotJSON, wantJSON)
+		}
+	}
+
+	if got := convertResult(nil); !reflect.DeepEqual(got, pResult{}) {
+		t.Errorf("convertResult(nil): got %+v, want an empty result", got)
+	}
+}
+
+// clearTypeStrings clears the VDL syntax of a type descriptor, which the
+// tests leave to vdl.Type.String.
+func clearTypeStrings(t *pType) {
+	if t == nil {
+		return
+	}
+	t.String = ""
+	clearTypeStrings(t.Elem)
+	clearTypeStrings(t.Key)
+	for _, f := range t.Fields {
+		clearTypeStrings(f.Type)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"v.io/v23/context"
+	"v.io/v23/naming"
+)
+
+// watchParams are the params of watch: the pattern and filters of a glob, and
+// how often to repeat it.
+type watchParams struct {
+	globParams
+
+	// How long to wait between globs. If zero, config.WatchInterval is used.
+	// It is at least config.MinWatchInterval.
+	Interval duration `json:"interval"`
+}
+
+/* watch globs a pattern over and over, and passes how its results change to
+ * send, until ctx is done:
+ *
+ * { event: "added", entry: <mount entry> } for each entry of the first glob,
+ * { synced: true } once they have all been sent,
+ * { event: "added" | "removed" | "changed", entry: <mount entry> } for each
+ *   entry that appears, disappears or changes servers or flags in a later
+ *   glob. The entry of a removed name is the last one seen.
+ * { err: <err> } if a glob fails. The watch goes on.
+ * { watchEnd: true, err: <err> } once the watch ends.
+ *
+ * Mount tables cannot be watched, so the namespace is polled. An entry that
+ * expires is removed by the first glob after its deadline. Names under a
+ * name that the glob could not read, and all names if the glob was
+ * truncated or timed out, are not reported as removed.
+ */
+func (b *NamespaceBrowser) watch(ctx *context.T, params string, opts requestOptions, send func(watchReturn)) {
+	var data watchParams
+	if err := json.Unmarshal([]byte(params), &data); err != nil {
+		send(watchReturn{WatchEnd: true, Err: fmt.Sprintf("bad params: %v", err)})
+		return
+	}
+	if data.Pattern == "" {
+		send(watchReturn{WatchEnd: true, Err: "bad params: pattern is required"})
+		return
+	}
+	interval := time.Duration(data.Interval)
+	if interval == 0 {
+		interval = time.Duration(b.config.WatchInterval)
+	}
+	if min := time.Duration(b.config.MinWatchInterval); interval < min {
+		interval = min
+	}
+	fmt.Printf("Watch: %s every %v\n", data.Pattern, interval)
+
+	var known map[string]naming.MountEntry
+	for {
+		current := map[string]naming.MountEntry{}
+		var failed []string // The names that could not be globbed.
+		truncated := false
+		globCtx, cancelGlob := b.timed(ctx, "glob", opts)
+		err := b.streamGlob(globCtx, data.globParams, opts, func(res globReturn) {
+			switch {
+			case res.GlobRes != nil:
+				// Like the browser, prefer the entry with servers when a
+				// name is globbed twice.
+				if old, ok := current[res.GlobRes.Name]; !ok || len(old.Servers) == 0 {
+					current[res.GlobRes.Name] = *res.GlobRes
+				}
+			case res.GlobErr != nil:
+				failed = append(failed, res.GlobErr.Name)
+			case res.GlobEnd:
+				truncated = res.Truncated
+			}
+		})
+		// A glob cut short by its deadline is as incomplete as a truncated
+		// one.
+		if globCtx.Err() != nil {
+			truncated = true
+		}
+		cancelGlob()
+		if _, ok := err.(badParamsError); ok {
+			send(watchReturn{WatchEnd: true, Err: fmt.Sprintf("%v", err)})
+			return
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		switch {
+		case err != nil:
+			send(watchReturn{Err: fmt.Sprintf("%v", err)})
+		case known == nil:
+			for _, name := range sortedEntryNames(current) {
+				entry := current[name]
+				send(watchReturn{Event: "added", Entry: &entry})
+			}
+			send(watchReturn{Synced: true})
+			known = current
+		default:
+			for _, name := range sortedEntryNames(current) {
+				entry := current[name]
+				old, ok := known[name]
+				switch {
+				case !ok:
+					send(watchReturn{Event: "added", Entry: &entry})
+				case entryChanged(old, entry):
+					send(watchReturn{Event: "changed", Entry: &entry})
+				}
+			}
+			for _, name := range sortedEntryNames(known) {
+				if _, ok := current[name]; ok {
+					continue
+				}
+				if truncated || under(name, failed) {
+					// It may still be there; keep it until it is seen.
+					current[name] = known[name]
+					continue
+				}
+				entry := known[name]
+				send(watchReturn{Event: "removed", Entry: &entry})
+			}
+			known = current
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	send(watchReturn{WatchEnd: true})
+}
+
+// entryChanged returns true if the servers or flags of an entry changed. The
+// deadlines are left out, since they change every time a server refreshes
+// its mount.
+func entryChanged(old, entry naming.MountEntry) bool {
+	if old.ServesMountTable != entry.ServesMountTable || old.IsLeaf != entry.IsLeaf {
+		return true
+	}
+	servers := func(e naming.MountEntry) []string {
+		var ret []string
+		for _, s := range e.Servers {
+			ret = append(ret, s.Server)
+		}
+		sort.Strings(ret)
+		return ret
+	}
+	return !reflect.DeepEqual(servers(old), servers(entry))
+}
+
+// under returns true if name is one of names, or under one of them.
+func under(name string, names []string) bool {
+	for _, n := range names {
+		if name == n || strings.HasPrefix(name, n+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedEntryNames(entries map[string]naming.MountEntry) []string {
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,274 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"v.io/v23"
+	"v.io/v23/context"
+)
+
+// The WebSocket is served at this path, both on the API server and, in
+// single-port mode, on the web server.
+const WS_PATH = API_PATH + "/ws"
+
+var upgrader = websocket.Upgrader{
+	// The origin has already been checked by authorize.
+	CheckOrigin: func(req *http.Request) bool { return true },
+}
+
+/* wsRequest is a message from the browser on the WebSocket. Each one either
+ * starts a request, with the same request types and params as the EventSource
+ * protocol (see ServeHTTP), or cancels the running request with the given ID:
+ *
+ * { id: <int>, request: <string>, params: <params>,
+ *   timeout: <string>, retries: <int>, profile: <string>, roots: []<string> }
+ * { id: <int>, cancel: true }
+ *
+ * The timeout, retries, profile and roots are optional; see requestOptions.
+ * Without a profile or roots, a request uses those of the session, given by
+ * the profile and roots query parameters of the WebSocket URL, or else the
+ * default ones.
+ */
+type wsRequest struct {
+	ID      uint64          `json:"id"`
+	Request string          `json:"request"`
+	Params  json.RawMessage `json:"params"`
+	Cancel  bool            `json:"cancel"`
+	Timeout duration        `json:"timeout"`
+	Retries int             `json:"retries"`
+	Profile string          `json:"profile"`
+	Roots   []string        `json:"roots"`
+}
+
+func (msg wsRequest) options() requestOptions {
+	return requestOptions{Timeout: msg.Timeout, Retries: msg.Retries, Profile: msg.Profile, Roots: msg.Roots}
+}
+
+// wsResponse is a message to the browser. Data holds what the EventSource
+// protocol would send as an event; End is set on the last response to the
+// request with the given ID. Profile and Roots are the credential profile and
+// namespace roots the request used.
+type wsResponse struct {
+	ID      uint64      `json:"id"`
+	Data    interface{} `json:"data"`
+	End     bool        `json:"end"`
+	Profile string      `json:"profile,omitempty"`
+	Roots   []string    `json:"roots,omitempty"`
+}
+
+// wsConn is a WebSocket from the browser that multiplexes many requests.
+type wsConn struct {
+	b    *NamespaceBrowser
+	conn *websocket.Conn
+
+	// ctx lives as long as the WebSocket. The contexts of the requests are
+	// derived from it, so closing the WebSocket cancels them all.
+	ctx       *context.T
+	cancelAll context.CancelFunc
+
+	writeMu sync.Mutex // Serializes writes to conn.
+
+	mu      sync.Mutex
+	running map[uint64]*wsRunning // The running requests, by ID.
+}
+
+// wsRunning is a running request. Once it has been canceled, its ID may be
+// reused by a new request while it finishes, so it is told apart from the new
+// one by its address.
+type wsRunning struct {
+	cancel context.CancelFunc
+}
+
+// serveWebSocket serves the requests of a browser session over a WebSocket
+// until the browser closes it.
+func (b *NamespaceBrowser) serveWebSocket(rw http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		// The upgrader has already responded with an error.
+		fmt.Println(err)
+		return
+	}
+	// The session uses the profile and roots of the WebSocket URL, if any.
+	base, err := b.namespaces.context(req.FormValue("profile"), parseRoots(req.FormValue("roots")))
+	if err != nil {
+		conn.WriteJSON(wsResponse{Data: errorReturn{Err: fmt.Sprintf("%v", err)}, End: true})
+		conn.Close()
+		return
+	}
+	ctx, cancelAll := context.WithCancel(base)
+	c := &wsConn{
+		b:         b,
+		conn:      conn,
+		ctx:       ctx,
+		cancelAll: cancelAll,
+		running:   map[uint64]*wsRunning{},
+	}
+	defer c.close()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				fmt.Println(err)
+			}
+			return
+		}
+		// A message that cannot be decoded only fails its own request.
+		var msg wsRequest
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.send(wsResponse{ID: messageID(data), Data: errorReturn{Err: fmt.Sprintf("bad message: %v", err)}, End: true})
+			continue
+		}
+		if msg.Cancel {
+			c.cancel(msg.ID)
+			continue
+		}
+		fmt.Println("WebSocket request", msg.ID, msg.Request, "params", string(msg.Params))
+		if err := msg.options().check(); err != nil {
+			c.send(wsResponse{ID: msg.ID, Data: errorReturn{Err: fmt.Sprintf("%v", err)}, End: true})
+			continue
+		}
+		scopeCtx, cancelScope, err := b.withScope(c.ctx, msg.Profile, msg.Roots)
+		if err != nil {
+			c.send(wsResponse{ID: msg.ID, Data: errorReturn{Err: fmt.Sprintf("%v", err)}, End: true})
+			continue
+		}
+		ctx, cancelRequest := b.timed(scopeCtx, msg.Request, msg.options())
+		cancel := func() {
+			cancelRequest()
+			cancelScope()
+		}
+		r := &wsRunning{cancel: cancel}
+		if !c.start(msg.ID, r) {
+			cancel()
+			c.send(wsResponse{ID: msg.ID, Data: errorReturn{Err: fmt.Sprintf("request %d is already running", msg.ID)}, End: true})
+			continue
+		}
+		go c.serve(ctx, msg, r)
+	}
+}
+
+// messageID returns the ID of a message that could not be decoded, if it has
+// a valid one, or else 0.
+func messageID(data []byte) uint64 {
+	var msg struct {
+		ID uint64 `json:"id"`
+	}
+	json.Unmarshal(data, &msg)
+	return msg.ID
+}
+
+// serve performs a request and sends its responses.
+func (c *wsConn) serve(ctx *context.T, msg wsRequest, r *wsRunning) {
+	defer c.finish(msg.ID, r)
+
+	profile, roots := profileOf(ctx), v23.GetNamespace(ctx).Roots()
+	send := func(data interface{}, end bool) {
+		c.send(wsResponse{ID: msg.ID, Data: data, End: end, Profile: profile, Roots: roots})
+	}
+	params := string(msg.Params)
+	if msg.Request == "glob" {
+		globParams, err := parseGlobParams(params)
+		if err != nil {
+			send(globReturn{Err: fmt.Sprintf("bad params: %v", err)}, true)
+			return
+		}
+		c.b.cachedGlob(ctx, globParams, msg.options(), func(res globReturn) {
+			send(res, res.GlobEnd || res.Err != "")
+		})
+		return
+	}
+	if msg.Request == "streamRPC" {
+		c.b.streamRPC(ctx, params, func(res streamRPCReturn) {
+			send(res, res.StreamEnd)
+		})
+		return
+	}
+	if msg.Request == "watch" {
+		c.b.watch(ctx, params, msg.options(), func(res watchReturn) {
+			send(res, res.WatchEnd)
+		})
+		return
+	}
+	if msg.Request == "deleteTree" {
+		c.b.deleteTree(ctx, params, msg.options(), func(res deleteTreeReturn) {
+			send(res, res.DeleteEnd)
+		})
+		return
+	}
+
+	res, err := c.b.handleWithRetries(ctx, msg.Request, params, msg.options())
+	if _, ok := err.(badParamsError); ok {
+		res = errorReturn{Err: fmt.Sprintf("bad params: %v", err)}
+	} else if err == errUnknownRequest {
+		res = errorReturn{Err: fmt.Sprintf("unknown request %q", msg.Request)}
+	}
+	send(res, true)
+}
+
+// start records a running request. It returns false if a request with the
+// same ID is already running.
+func (c *wsConn) start(id uint64, r *wsRunning) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.running[id]; ok {
+		return false
+	}
+	c.running[id] = r
+	return true
+}
+
+// cancel cancels the request with the given ID, if it is still running.
+func (c *wsConn) cancel(id uint64) {
+	c.mu.Lock()
+	r, ok := c.running[id]
+	delete(c.running, id)
+	c.mu.Unlock()
+	if ok {
+		r.cancel()
+	}
+}
+
+// finish releases a request once it has been served. If it was canceled and
+// its ID has been reused since, the new request is left alone.
+func (c *wsConn) finish(id uint64, r *wsRunning) {
+	c.mu.Lock()
+	if c.running[id] == r {
+		delete(c.running, id)
+	}
+	c.mu.Unlock()
+	r.cancel()
+}
+
+func (c *wsConn) send(res wsResponse) {
+	if c.ctx.Err() != nil {
+		return // The WebSocket is closed.
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.WriteJSON(res); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// close cancels every running request and closes the WebSocket. The
+// requests with their own profile or roots are not derived from c.ctx, so
+// they are canceled one by one.
+func (c *wsConn) close() {
+	c.cancelAll()
+	c.mu.Lock()
+	for _, r := range c.running {
+		r.cancel()
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// writeYAML writes v as YAML. v is first encoded as JSON, so its JSON tags
+// apply, and the fields keep their order. Strings are always quoted, so that
+// they are never read back as numbers or bools.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := readYAMLNode(dec)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("---")
+	writeYAMLNode(bw, node, 0)
+	return bw.Flush()
+}
+
+// yamlMap is a JSON object, with its keys in order.
+type yamlMap []yamlPair
+
+type yamlPair struct {
+	key   string
+	value interface{}
+}
+
+// readYAMLNode reads the next JSON value from dec. Objects are read as
+// yamlMap, arrays as []interface{}, and other values as they are decoded.
+func readYAMLNode(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, yamlPair{key.(string), value})
+		}
+		_, err := dec.Token() // The closing brace.
+		return m, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := readYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token() // The closing bracket.
+		return list, err
+	}
+	return tok, nil
+}
+
+// writeYAMLNode writes node as the value of a key, or an item of a list, at
+// the given indentation. The key or the dash have already been written.
+func writeYAMLNode(w *bufio.Writer, node interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+	switch v := node.(type) {
+	case yamlMap:
+		if len(v) == 0 {
+			w.WriteString(" {}\n")
+			return
+		}
+		w.WriteString("\n")
+		for _, pair := range v {
+			fmt.Fprintf(w, "%s%s:", prefix, yamlKey(pair.key))
+			writeYAMLNode(w, pair.value, indent+1)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			w.WriteString(" []\n")
+			return
+		}
+		w.WriteString("\n")
+		for _, item := range v {
+			fmt.Fprintf(w, "%s-", prefix)
+			writeYAMLNode(w, item, indent+1)
+		}
+	default:
+		fmt.Fprintf(w, " %s\n", yamlScalar(v))
+	}
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func yamlKey(key string) string {
+	if plainYAMLKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return strconv.Quote(fmt.Sprint(v))
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteYAML(t *testing.T) {
+	type entry struct {
+		Name    string   `json:"name"`
+		Servers []string `json:"servers"`
+		IsLeaf  bool     `json:"isLeaf"`
+		Err     string   `json:"err,omitempty"`
+	}
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{"a", "--- \"a\"\n"},
+		{42, "--- 42\n"},
+		{nil, "--- null\n"},
+		{[]string{}, "--- []\n"},
+		{map[string]int{}, "--- {}\n"},
+		// Strings that look like numbers or bools stay strings.
+		{[]string{"true", "12", "null", "a: b", "line\nbreak"}, `---
+- "true"
+- "12"
+- "null"
+- "a: b"
+- "line\nbreak"
+`},
+		// Fields keep their order and JSON tags.
+		{entry{Name: "house/lights", Servers: []string{"/s1", "/s2"}, IsLeaf: true}, `---
+name: "house/lights"
+servers:
+  - "/s1"
+  - "/s2"
+isLeaf: true
+`},
+		{[]entry{{Name: "a", Servers: []string{}}, {Name: "b", Err: "no access"}}, `---
+-
+  name: "a"
+  servers: []
+  isLeaf: false
+-
+  name: "b"
+  servers: null
+  isLeaf: false
+  err: "no access"
+`},
+		// Keys that are not plain are quoted.
+		{map[string]map[string]float64{"dev.v.io:u:alice": {"1": 1.5}}, `---
+"dev.v.io:u:alice":
+  "1": 1.5
+`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeYAML(&buf, test.v); err != nil {
+			t.Errorf("writeYAML(%#v) failed: %v", test.v, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("writeYAML(%#v): got\n%s\nwant\n%s", test.v, got, test.want)
+		}
+	}
+
+	if err := writeYAML(&bytes.Buffer{}, func() {}); err == nil {
+		t.Errorf("writeYAML of a func did not fail")
+	}
+}
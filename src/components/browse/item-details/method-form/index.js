@@ -680,13 +680,10 @@ function renderRPCRunButton(state, events) {
  * from state.args, a starred invocation's arguments, or a recommendation's.
  */
 function getRunEvent(state, events, args) {
-  var methodData = getMethodData(state.interface, state.methodName);
-  var outArgList = methodData.outArgs || [];
   return mercury.event(events.runAction, {
     name: state.itemName,
     methodName: state.methodName,
-    args: args,
-    numOutArgs: outArgList.length
+    args: args
   });
 }
 
@@ -16,10 +16,9 @@ module.exports = makeRPC;
  * data needs to have name, methodName, and args.
  */
 function makeRPC(data) {
-  // TODO(alexfandrianto): Once JS signatures have type information and/or VOM
-  // gets better, we can be smarter about this.
   // Parse if possible. Otherwise, a string (or invalid JSON) will be used.
-  // Solves a problem where booleans did not seem to be parsed properly.
+  // namespace-browserd converts the parsed values to the types in the method's
+  // signature, and reports which argument did not fit.
   var args = data.args.map(function(arg) {
     arg = arg || ''; // 'undefined' input should be treated as ''.
 
@@ -31,7 +30,7 @@ function makeRPC(data) {
   });
 
   return namespaceService.makeRPC(
-    data.name, data.methodName, args, data.numOutArgs).catch(function(err) {
+    data.name, data.methodName, args).catch(function(err) {
       log.error('Error during RPC',
         data.name,
         data.methodName,
@@ -8,6 +8,8 @@ var insertCss = require('insert-css');
 var displayMountPointDetails = require('./display-mountpoint-details');
 var mountPointManager = require('./manage-mountpoint');
 
+var namespaceService = require('../../../../services/namespace/service');
+
 var dialogClickHook = require('../../../../lib/mercury/dialog-click-hook');
 var FieldItem = require('../field-item');
 var ErrorBox = require('../../../error/error-box');
@@ -320,13 +322,28 @@ function formatPermission(perm) {
 // Wire up events that we know how to handle
 function wireUpEvents(state, events) {
   events.promptDeleteMountPoint(function(data) {
+    // List the names under the mount point, which are deleted with it.
+    namespaceService.previewDeleteTree(data.name).then(function(preview) {
+      var others = preview.names.filter(function(name) {
+        return name !== data.name;
+      }).length;
+      var text = 'Are you sure you want to delete ' + data.name;
+      if (others > 0) {
+        text += ' and the ' + others + ' names under it';
+      }
+      promptDelete(data, text + ' ?', preview.token);
+    }, function(err) {
+      log.error('Could not list the names under', data.name, err);
+      promptDelete(data, 'Are you sure you want to delete ' + data.name + ' ?');
+    });
+  });
+
+  function promptDelete(data, text, token) {
     state.promptAction.set(true);
-    state.promptActionText.set(
-      'Are you sure you want to delete ' + data.name + ' ?'
-    );
+    state.promptActionText.set(text);
     state.promptActionButtonText.set('Delete');
-    state.promptActionCallback.set(deleteMountPoint.bind(null, data));
-  });
+    state.promptActionCallback.set(deleteMountPoint.bind(null, data, token));
+  }
 
   events.promptCanceled(function() {
     state.promptAction.set(false);
@@ -338,8 +355,8 @@ function wireUpEvents(state, events) {
     state.promptAction.set(false);
   });
 
-  function deleteMountPoint(data) {
-    mountPointManager.deleteMountPoint(state, events).then(function() {
+  function deleteMountPoint(data, token) {
+    mountPointManager.deleteMountPoint(state, events, token).then(function() {
       if (data.cb) {
         data.cb();
       }
@@ -13,12 +13,14 @@ module.exports = {
 };
 
 /*
- * Delete a given mountpoint
+ * Delete a given mountpoint. With the token of a previewDeleteTree, the names
+ * under it are deleted too.
  */
- //TODO(aghassemi) Prompt for confirmation
-function deleteMountPoint(state, events) {
+function deleteMountPoint(state, events, token) {
   var name = state.itemName;
-  return namespaceService.deleteMountPoint(name).then(function() {
+  var deleted = token ? deleteTree(name, token) :
+    namespaceService.deleteMountPoint(name);
+  return deleted.then(function() {
     events.toast({
       text: name + ' deleted successfully'
     });
@@ -37,3 +39,26 @@ function deleteMountPoint(state, events) {
     return Promise.reject(err);
   });
 }
+
+/*
+ * Returns a promise that deleteTree deleted every name, or rejects with the
+ * error of the first name that could not be deleted.
+ */
+function deleteTree(name, token) {
+  return new Promise(function(resolve, reject) {
+    var failures = [];
+    var stream = namespaceService.deleteTree(name, token);
+    stream.on('failed', function(failedName, err) {
+      log.error('Could not delete', failedName, err);
+      failures.push(err);
+    });
+    stream.on('end', function() {
+      if (failures.length > 0) {
+        reject(failures[0]);
+      } else {
+        resolve();
+      }
+    });
+    stream.on('error', reject);
+  });
+}
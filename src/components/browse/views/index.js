@@ -22,6 +22,9 @@ module.exports.clearCache = clearCache;
 
 var VALID_VIEW_TYPES = ['grid', 'tree', 'visualize'];
 
+// The grid view shows at most this many search results.
+var MAX_SEARCH_RESULTS = 1000;
+
 /*
  * Items view.
  * Renders one of: Grid, Tree or Visualize views depending on the state
@@ -128,14 +131,21 @@ function load(state, namespace, globQuery) {
   state.put('items', mercury.array([]));
 
   return new Promise(function(resolve, reject) {
-    namespaceService.search(namespace, globQuery).
+    var options = { maxResults: MAX_SEARCH_RESULTS };
+    namespaceService.search(namespace, globQuery, options).
     then(function globResultsReceived(items) {
       if (!isCurrentRequest()) {
         resolve();
         return;
       }
       state.put('items', items);
-      items.events.once('end', loadingFinished);
+      items.events.once('end', function(truncated) {
+        if (truncated) {
+          log.warn('Showing the first', MAX_SEARCH_RESULTS, 'results of',
+            globQuery);
+        }
+        loadingFinished();
+      });
       items.events.on('globError', loadingFinished);
     }).catch(function(err) {
       log.error(err);
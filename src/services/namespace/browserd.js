@@ -0,0 +1,234 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+ * Connection to namespace-browserd. Every request of the browser session is
+ * carried by a single WebSocket, which is opened on the first request and
+ * reopened if it closes. See websocket.go in namespace-browserd.
+ *
+ *  var stream = browserd.request('glob', pattern);
+ *  stream.on('data', function(data, roots, profile) { ... }); // Each
+ *    // response, with the namespace roots and profile the request used.
+ *  stream.on('end', function() { ... }); // After the last response.
+ *  stream.on('error', function(err) { ... }); // If the connection failed.
+ *  stream.cancel(); // Stops the request. No more events are emitted.
+ */
+var EventEmitter = require('events').EventEmitter;
+var extend = require('extend');
+var log = require('../../lib/log')('services:namespace:browserd');
+
+module.exports = {
+  request: request,
+  setRoots: setRoots,
+  getRoots: getRoots,
+  setProfile: setProfile,
+  getProfile: getProfile
+};
+
+// The WebSocket URL used when namespace-browserd does not serve its client
+// config, e.g. when the app is served by another static file server.
+var DEFAULT_WEB_SOCKET_URL = 'ws://127.0.0.1:9002/api/ws';
+
+// The daemon serving the app reports where its API is in config.json.
+var CLIENT_CONFIG_URL = 'config.json';
+
+var nextId = 1;
+var streams = {}; // The running requests, by id.
+
+// The namespace roots of the session. If empty, the daemon's are used.
+var sessionRoots = [];
+
+// The credential profile of the session. If empty, the daemon's default
+// credentials are used.
+var sessionProfile = '';
+
+/*
+ * Sets the namespace roots used by the requests that do not give their own,
+ * e.g. to browse another deployment's mount tables. An empty list restores
+ * the daemon's default roots.
+ * @param {Array<string>} roots Rooted names, e.g. '/ns.dev.example.com:8101'.
+ */
+function setRoots(roots) {
+  sessionRoots = (roots || []).slice();
+}
+
+/*
+ * Returns the namespace roots of the session. An empty list means the
+ * daemon's default roots.
+ * @return {Array<string>}
+ */
+function getRoots() {
+  return sessionRoots.slice();
+}
+
+/*
+ * Sets the credential profile that requests act as when they do not give
+ * their own. An empty name restores the daemon's default credentials.
+ * @param {string} profile The name of a profile loaded by the daemon.
+ */
+function setProfile(profile) {
+  sessionProfile = profile || '';
+}
+
+/*
+ * Returns the credential profile of the session, or '' for the default.
+ * @return {string}
+ */
+function getProfile() {
+  return sessionProfile;
+}
+
+/*
+ * Starts a request on namespace-browserd.
+ * @param {string} type The request type, e.g. 'glob' or 'makeRPC'.
+ * @param {*} params The parameters of the request.
+ * @param {object} [options] Optional settings of the request:
+ *   timeout {string} How long it may take, e.g. '30s'.
+ *   retries {number} How often to retry it after transient errors.
+ *   roots {Array<string>} The namespace roots to use instead of the
+ *     session's.
+ *   profile {string} The credential profile to act as instead of the
+ *     session's.
+ * @return {EventEmitter} Stream of responses to the request.
+ */
+function request(type, params, options) {
+  var id = nextId++;
+  var stream = new EventEmitter();
+  var sent = false;
+  streams[id] = stream;
+
+  stream.cancel = function() {
+    if (!streams[id]) {
+      return; // It has already ended.
+    }
+    delete streams[id];
+    if (sent) {
+      getSocket().then(function(ws) {
+        ws.send(JSON.stringify({ id: id, cancel: true }));
+      }).catch(function(err) {
+        log.warn('Could not cancel request', id, err);
+      });
+    }
+  };
+
+  getSocket().then(function(ws) {
+    if (!streams[id]) {
+      return; // It was canceled before it was sent.
+    }
+    var session = {
+      roots: sessionRoots.length ? sessionRoots : undefined,
+      profile: sessionProfile || undefined
+    };
+    ws.send(JSON.stringify(extend(session, options, {
+      id: id,
+      request: type,
+      params: params === undefined ? '' : params
+    })));
+    sent = true;
+  }).catch(function(err) {
+    fail(id, err);
+  });
+
+  return stream;
+}
+
+/*
+ * Returns a Promise<WebSocket> of the open connection to namespace-browserd.
+ */
+var _socketPromise;
+function getSocket() {
+  if (!_socketPromise) {
+    _socketPromise = getWebSocketURL().then(function(url) {
+      return new Promise(function(resolve, reject) {
+        var ws = new WebSocket(url); // jshint ignore:line
+        ws.onopen = function() {
+          resolve(ws);
+        };
+        ws.onmessage = handleMessage;
+        ws.onclose = function() {
+          // The next request reconnects; the running ones have failed.
+          _socketPromise = null;
+          var err = new Error('Connection to namespace-browserd closed');
+          Object.keys(streams).forEach(function(id) {
+            fail(id, err);
+          });
+          reject(err);
+        };
+      });
+    });
+  }
+  return _socketPromise;
+}
+
+function handleMessage(message) {
+  var data;
+  try {
+    data = JSON.parse(message.data);
+  } catch (err) {
+    log.error('Bad message from namespace-browserd', err);
+    return;
+  }
+  var stream = streams[data.id];
+  if (!stream) {
+    return; // The request was canceled.
+  }
+  if (data.end) {
+    delete streams[data.id];
+  }
+  stream.emit('data', data.data, data.roots, data.profile);
+  if (data.end) {
+    stream.emit('end');
+  }
+}
+
+function fail(id, err) {
+  var stream = streams[id];
+  if (stream) {
+    delete streams[id];
+    stream.emit('error', err);
+  }
+}
+
+/*
+ * Returns a Promise<string> of the WebSocket URL of namespace-browserd, with
+ * the API token that every request must present. WebSockets cannot set
+ * headers, so it is a query parameter.
+ */
+function getWebSocketURL() {
+  return new Promise(function(resolve) {
+    var xhr = new XMLHttpRequest(); // jshint ignore:line
+    xhr.open('GET', CLIENT_CONFIG_URL);
+    xhr.onload = function() {
+      try {
+        var config = JSON.parse(xhr.responseText);
+        var url = absoluteURL(config.webSocketURL || DEFAULT_WEB_SOCKET_URL);
+        resolve(withToken(url, config.token));
+      } catch (err) {
+        resolve(DEFAULT_WEB_SOCKET_URL);
+      }
+    };
+    xhr.onerror = function() {
+      resolve(DEFAULT_WEB_SOCKET_URL);
+    };
+    xhr.send();
+  });
+}
+
+// The daemon gives a URL without a host when it serves the WebSocket next to
+// the app, so it is resolved against the page.
+function absoluteURL(url) {
+  if (url[0] !== '/') {
+    return url;
+  }
+  var scheme = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
+  return scheme + window.location.host + url;
+}
+
+function withToken(url, token) {
+  if (!token) {
+    return url;
+  }
+  var separator = url.indexOf('?') === -1 ? '?' : '&';
+  return url + separator + 'token=' + encodeURIComponent(token);
+}
@@ -5,86 +5,135 @@
 var mercury = require('mercury');
 var LRU = require('lru-cache');
 var EventEmitter = require('events').EventEmitter;
+var extend = require('extend');
 var itemFactory = require('./item');
 var freeze = require('../../lib/mercury/freeze');
 var sortedPush = require('../../lib/mercury/sorted-push-array');
 var log = require('../../lib/log')('services:namespace:service');
 var naming = require('./naming-util.js');
+var browserd = require('./browserd');
 naming.parseName = parseName;
 
 module.exports = {
   getChildren: getChildren,
   getNamespaceItem: getNamespaceItem,
   getRemoteBlessings: getRemoteBlessings,
+  getBlessingDetails: getBlessingDetails,
   getSignature: getSignature,
   getAccountName: getAccountName,
   getEmailAddress: getEmailAddress,
   getObjectAddresses: getObjectAddresses,
   getPermissions: getPermissions,
+  setPermissions: setPermissions,
+  explainAccess: explainAccess,
   resolveToMounttable: resolveToMounttable,
   makeRPC: makeRPC,
+  makeStreamingRPC: makeStreamingRPC,
   search: search,
+  watch: watch,
   util: naming,
   clearCache: clearCache,
+  setRoots: setRoots,
+  getRoots: browserd.getRoots,
+  getProfiles: getProfiles,
+  getPolicy: getPolicy,
+  getPrincipal: getPrincipal,
+  setDefaultBlessing: setDefaultBlessing,
+  addRoot: addRoot,
+  setProfile: setProfile,
+  getProfile: browserd.getProfile,
   deleteMountPoint: deleteMountPoint,
+  previewDeleteTree: previewDeleteTree,
+  deleteTree: deleteTree,
+  mount: mount,
+  unmount: unmount,
   prefixes: prefixes
 };
 
 
 /*
- * Returns an EventSource object connected to the local network.
+ * The API of namespace-browserd. Requests are made through browserd.js.
  * Only certain types of requests are allowed.
  *
  * accountName: <no parameters>  => { accountName: <string>, err: <err> }
- * glob: string pattern  => a stream of responses
- *   { globRes: <glob res>, globErr: <glob err>, globEnd: <bool>, err: <err> }
- * permissions: string name =>  { permissions: <permissions>, err: <err> }
+ * policy: <no parameters> => { readOnly: <bool>, allowedTags: []<string>,
+ *   err: <err> }
+ * profiles: <no parameters> => { profiles: []{ name: <string>,
+ *   credentials: <dir>, publicKey: <string>, blessings: []<string> },
+ *   err: <err> }
+ * principal: <no parameters> => { profile: <string>, publicKey: <string>,
+ *   default: <stored blessing>, blessings: []{ peerPattern: <pattern>,
+ *   names: []<string>, chains: []<chain>, expiry: <time>,
+ *   expiresIn: <string>, expired: <bool> }, roots: []{ pattern: <pattern>,
+ *   publicKey: <string>, der: <base64> }, err: <err> }
+ * setDefaultBlessing: { blessing: <string> } => same as principal
+ * addRoot: { publicKey: <base64 DER>, pattern: <pattern> } => same as
+ *   principal
+ * glob: string pattern, or { pattern: <string>, maxDepth: <int>,
+ *       maxResults: <int>, leafOnly: <bool>, mountTableOnly: <bool>,
+ *       nameRegex: <string>, serverBlessings: <pattern> }
+ *   => a stream of responses { globRes: <glob res>, globErr: <glob err>,
+ *      globEnd: <bool>, truncated: <bool>, err: <err> }
+ * permissions: string name =>
+ *   { permissions: <permissions>, version: <string>, err: <err> }
+ * setPermissions: { name: <string>, permissions: <permissions>,
+ *                   version: <string>, force: <bool>, dryRun: <bool> } =>
+ *   { version: <string>, changes: []{ pattern: <string>, tag: <string>,
+ *     change: "gains"|"loses", list: "in"|"notIn" }, err: <err> }
+ * explainAccess: { name: <string>, blessings: []<string> } =>
+ *   { blessings: []<string>, tags: []{ tag: <string>, granted: <bool>,
+ *     reason: <string>, blessings: []{ blessing: <string>,
+ *     grantedBy: <pattern>, deniedBy: <pattern> } }, err: <err> }
  * deleteMountPoint: string name => { err: <err string> }
+ *   (fails if the name has children; see deleteTree)
+ * watch: { pattern: <string>, interval: <string>, and the glob options } =>
+ *   a stream of responses { event: "added"|"removed"|"changed",
+ *   entry: <mount entry>, synced: <bool>, watchEnd: <bool>, err: <err> }
+ * deleteTree: { name: <string>, dryRun: <bool>, token: <string> } =>
+ *   a stream of responses { name: <string>, deleted: <bool>, token: <string>,
+ *   deleteEnd: <bool>, err: <err> }
+ * mount: { name: <string>, server: <string>, ttl: <string>,
+ *          servesMountTable: <bool>, isLeaf: <bool>, replace: <bool> } =>
+ *        { err: <err> }
+ * unmount: { name: <string>, server: <string> } => { err: <err> }
  * resolveToMounttable: string name => { addresses: []<string>, err: <err> }
  * objectAddresses: string name => { addresses: []<string>, err: <err> }
- * remoteBlessings: string name => { blessings: []<string>, err: <err> }
+ * remoteBlessings: string name => { blessings: []<string>,
+ *   publicKey: <string>, chains: []{ name: <string>, certificates: []{
+ *   extension: <string>, issuer: <string>, publicKey: <string>,
+ *   caveats: []{ description: <string>, expiry: <time> } },
+ *   expiry: <time> }, rejected: []{ blessing: <string>, reason: <string> },
+ *   err: <err> }
  * signature: string name => { signature: <signature>, err: <err> }
- * makeRPC: { name: <string>, methodName: <string>, args: []<string>,
- *            numOutArgs: <int> } =>
- *          { response: <undefined, output, OR []outputs>, err: <err> }
+ * makeRPC: { name: <string>, methodName: <string>, args: []<JSON> } =>
+ *          { response: []{ value: <JSON>, type: <type> }, err: <err> }
+ * streamRPC: same as makeRPC => a stream of responses
+ *   { streamId: <string>, item: { value: <JSON>, type: <type> },
+ *     response: []{ value: <JSON>, type: <type> },
+ *     streamEnd: <bool>, err: <err> }
+ * streamSend: { streamId: <string>, item: <item> } => { err: <err> }
+ * streamCloseSend: { streamId: <string> } => { err: <err> }
+ *
+ * Every request may also give the namespace roots to use and the credential
+ * profile to act as; browserd.js sends those of the session. Each response
+ * reports the roots and profile that were used.
  */
-// TODO(alexfandrianto): Make this configurable here and on the Go end.
-// https://github.com/vanadium/issues/issues/1268
-var eventSourceURL = 'http://127.0.0.1:9002';
-function connectToEventSource(requestType, parameters) {
-  parameters = parameters || '';
-  var requestData = eventSourceURL +
-    '?request=' + encodeURIComponent(requestType) +
-    '&params=' + encodeURIComponent(JSON.stringify(parameters));
-
-  // Create the EventSource. Note: node does not have EventSource.
-  return new EventSource(requestData); // jshint ignore:line
-}
 
 /*
- * Returns a Promise<value> drawn from the connected Event Source.
- * See connectToEventSource.
+ * Returns a Promise<value> drawn from the single response to a request.
+ * If no field is given, the whole response is the value.
  */
 function getSingleEvent(type, params, field) {
   return new Promise(function(resolve, reject) {
-    var ev = connectToEventSource(type, params);
-    ev.addEventListener('message', function(message) {
-      ev.close();
-      try {
-        var data = JSON.parse(message.data);
-        if (data.err) {
-          reject(data.err);
-        } else {
-          resolve(data[field]);
-        }
-      } catch (err) {
-        reject(err);
+    var stream = browserd.request(type, params);
+    stream.on('data', function(data) {
+      if (data.err) {
+        reject(data.err);
+      } else {
+        resolve(field === undefined ? data : data[field]);
       }
     });
-    ev.addEventListener('error', function(err) {
-      ev.close();
-      reject(err);
-    });
+    stream.on('error', reject);
   });
 }
 
@@ -101,6 +150,77 @@ function getAccountName() {
   return _accountNamePromise;
 }
 
+/*
+ * Returns the policy of namespace-browserd: whether it is read-only, and the
+ * method tags that RPCs are limited to, if any. Requests that it refuses
+ * fail with an error.
+ * @return {Promise.<object>} Promise of { readOnly, allowedTags }.
+ */
+var _policyPromise;
+function getPolicy() {
+  if (!_policyPromise) {
+    _policyPromise = getSingleEvent('policy');
+  }
+  return _policyPromise;
+}
+
+/*
+ * Returns the credential profiles that requests can act as, with the names
+ * of their default blessings. The daemon's own credentials are the profile
+ * named 'default'.
+ * @return {Promise.<Array<object>>}
+ */
+function getProfiles() {
+  return getSingleEvent('profiles', undefined, 'profiles');
+}
+
+/*
+ * Returns the principal of the session's profile: its public key, the
+ * blessings of its store with the peers they are presented to and when they
+ * expire, and the blessing roots it recognizes.
+ * @return {Promise.<object>}
+ */
+function getPrincipal() {
+  return getSingleEvent('principal');
+}
+
+/*
+ * Makes the stored blessing with the given name the default blessing of the
+ * session's profile.
+ * @param {string} blessing The name of a stored blessing.
+ * @return {Promise.<object>} The principal, as returned by getPrincipal.
+ */
+function setDefaultBlessing(blessing) {
+  _accountNamePromise = null;
+  clearCache();
+  return getSingleEvent('setDefaultBlessing', { blessing: blessing });
+}
+
+/*
+ * Makes the principal of the session's profile recognize a public key as the
+ * root of the blessings matched by pattern.
+ * @param {string} publicKey The base64 DER encoding of the key.
+ * @param {string} pattern A blessing pattern.
+ * @return {Promise.<object>} The principal, as returned by getPrincipal.
+ */
+function addRoot(publicKey, pattern) {
+  clearCache();
+  return getSingleEvent('addRoot', { publicKey: publicKey, pattern: pattern });
+}
+
+/*
+ * Switches the credential profile of the session, e.g. to see the namespace
+ * as a service account does. The cached results and account name belong to
+ * the previous profile, so they are cleared.
+ * @param {string} profile The name of a profile. If empty, the daemon's
+ * default credentials are used.
+ */
+function setProfile(profile) {
+  browserd.setProfile(profile);
+  _accountNamePromise = null;
+  clearCache();
+}
+
 /*
  * Returns the email address for the currently logged in user
  * @return {Promise.<string>}
@@ -128,14 +248,22 @@ var globCache = new LRU({
  * the changes.
  *
  * The observable result has an events property which is an EventEmitter
- * and emits 'end' and 'globError' events.
+ * and emits 'end' and 'globError' events. 'end' is given true if results
+ * were left out because of options.maxResults.
  *
  * @param {string} pattern Glob pattern
+ * @param {object} [options] Filters applied by namespace-browserd: maxDepth,
+ * maxResults, leafOnly, mountTableOnly, nameRegex and serverBlessings.
  * @return {Promise.<mercury.array>} Promise of an observable array
  * of namespace items
  */
-function glob(pattern) {
+function glob(pattern, options) {
   var cacheKey = GLOB_CACHE_PREFIX + pattern;
+  var params = pattern;
+  if (options) {
+    cacheKey += '|' + JSON.stringify(options);
+    params = extend({}, options, { pattern: pattern });
+  }
   var cacheHit = globCache.get(cacheKey);
   if (cacheHit) {
     // The addition of the end event to mark the end of a glob requires that
@@ -147,7 +275,7 @@ function glob(pattern) {
       cacheHit._hasEnded = false;
       cacheHit.events.removeAllListeners();
       process.nextTick(function() {
-        cacheHit.events.emit('end');
+        cacheHit.events.emit('end', cacheHit._truncated);
         cacheHit._hasEnded = true;
       });
     }
@@ -160,33 +288,23 @@ function glob(pattern) {
   var globItemsObservArrPromise =
     Promise.resolve().then(function callGlobOnNamespace() {
       return new Promise(function (resolve, reject) {
-        var ev = connectToEventSource('glob', pattern);
-        ev.addEventListener('error', function(err) {
-          ev.close();
+        var stream = browserd.request('glob', params);
+        stream.on('error', function(err) {
           reject(err);
         });
 
-        function handleMessageConnectionResponse(response) {
-          try {
-            var data = JSON.parse(response.data);
-            if (data.err) {
-              ev.close();
-              reject(data.err);
-            } else {
-              // We have successfully established the stream.
-              // Keep the event source open to listen for more.
-              resolve();
-            }
-          } catch (err) {
-            ev.close();
-            reject(err);
+        function handleMessageConnectionResponse(data) {
+          if (data.err) {
+            reject(data.err);
+          } else {
+            // We have successfully established the stream.
+            // Keep listening for more.
+            resolve();
           }
         }
 
-        function handleStreamEvent(message) {
+        function handleStreamEvent(data) {
           try {
-            var data = JSON.parse(message.data);
-
             if (data.globRes) {
               var globResult = data.globRes;
 
@@ -213,14 +331,14 @@ function glob(pattern) {
               immutableResult.events.emit('globError', err);
               log.warn('Glob stream error', err);
             } else if (data.globEnd) {
-              // Handle a glob end by emitting it. Close event source.
-              immutableResult.events.emit('end');
+              // Handle a glob end by emitting it. The stream ends with it.
+              immutableResult._truncated = !!data.truncated;
+              immutableResult.events.emit('end', immutableResult._truncated);
               immutableResult._hasEnded = true;
-              ev.close();
             } else {
-              // There was a data error. Close event source.
-              log.error('Event source error for', name, data.err);
-              ev.close();
+              // There was a data error. Stop the stream.
+              log.error('Glob stream error for', pattern, data.err);
+              stream.cancel();
 
               // If this were an RPC, we probably would have failed earlier.
               // So, we must also clear the cache key.
@@ -232,7 +350,7 @@ function glob(pattern) {
         }
 
         var initialResponse = false;
-        ev.addEventListener('message', function(response) {
+        stream.on('data', function(response) {
           if (!initialResponse) {
             // Check whether the RPC and stream connection was established.
             initialResponse = true;
@@ -278,6 +396,45 @@ function getNamespaceItem(objectName) {
   });
 }
 
+/*
+ * Watches the entries matched by a glob pattern, which namespace-browserd
+ * globs at an interval.
+ * @param {string} pattern Glob pattern
+ * @param {object} [options] interval {string}, e.g. '5s', and the glob
+ * options, @see glob.
+ * @return {EventEmitter} Emits 'added', 'removed' and 'changed' with the
+ * mount entry, 'synced' once the entries of the first glob have been added,
+ * 'globError' if a glob fails, and 'end' or 'error' once the watch ends. Has a
+ * cancel() method that ends the watch.
+ */
+function watch(pattern, options) {
+  var events = new EventEmitter();
+  var params = extend({}, options, { pattern: pattern });
+  var stream = browserd.request('watch', params);
+  stream.on('data', function(data) {
+    if (data.watchEnd) {
+      if (data.err) {
+        events.emit('error', data.err);
+      } else {
+        events.emit('end');
+      }
+    } else if (data.err) {
+      events.emit('globError', data.err);
+    } else if (data.synced) {
+      events.emit('synced');
+    } else {
+      events.emit(data.event, lowercasifyJSONObject(data.entry));
+    }
+  });
+  stream.on('error', function(err) {
+    events.emit('error', err);
+  });
+  events.cancel = function() {
+    stream.cancel();
+  };
+  return events;
+}
+
 /*
  * Given a name returns a promise of an observable array of immediate children
  * @param {string} parentName Object name to glob
@@ -299,15 +456,16 @@ function getChildren(parentName) {
  * the changes.
  * @param {name} parentName Object name to search in.
  * @param {string} pattern Glob search pattern.
+ * @param {object} [options] Glob options, @see glob.
  * @return {Promise.<mercury.array>} Promise of an observable array
  * of namespace items
  */
-function search(parentName, pattern) {
+function search(parentName, pattern, options) {
   parentName = parentName || '';
   if (parentName) {
     pattern = naming.join(parentName, pattern);
   }
-  return glob(pattern);
+  return glob(pattern, options);
 }
 
 /*
@@ -331,6 +489,43 @@ function getPermissions(name) {
 }
 
 
+/*
+ * Sets the permissions of a mount point, unless they changed since they were
+ * read. In a dry run, only tells how they would change.
+ * @param {string} name Name of the mount point.
+ * @param {object} permissions The permissions, by tag.
+ * @param {string} version The version the permissions were read at. It is
+ * required unless force or dryRun is set.
+ * @param {boolean} [dryRun] If true, the permissions are not changed.
+ * @param {boolean} [force] If true, the permissions are set without a
+ * version, overwriting any concurrent change.
+ * @return {Promise<object>} Promise of { version, changes }, the new version
+ * and the tags each blessing pattern gains or loses.
+ */
+function setPermissions(name, permissions, version, dryRun, force) {
+  return getSingleEvent('setPermissions', {
+    name: name,
+    permissions: permissions,
+    version: version,
+    force: !!force,
+    dryRun: !!dryRun
+  });
+}
+
+/*
+ * Explains which tags of a mount point's permissions some blessings are
+ * granted, and which patterns grant or deny them.
+ * @param {string} name Name of the mount point.
+ * @param {Array<string>} [blessings] Blessing names. The blessings of
+ * namespace-browserd if omitted.
+ * @return {Promise<object>} Promise of { blessings, tags }.
+ */
+function explainAccess(name, blessings) {
+  return getSingleEvent('explainAccess', {
+    name: name,
+    blessings: blessings || []
+  });
+}
 
 /*
  * Deletes a mount point.
@@ -342,6 +537,90 @@ function deleteMountPoint(name) {
   return getSingleEvent('deleteMountPoint', name, 'deleteMountPoint');
 }
 
+/*
+ * Lists a mount point and the names under it, which deleteTree would delete.
+ * @param {string} name Name of the mount point.
+ * @return {Promise<object>} Promise of { names, errors, token }: the names,
+ * the names that could not be listed with their errors, and the token that
+ * confirms the delete.
+ */
+function previewDeleteTree(name) {
+  return new Promise(function(resolve, reject) {
+    var preview = { names: [], errors: [] };
+    var stream = browserd.request('deleteTree', { name: name, dryRun: true });
+    stream.on('data', function(data) {
+      if (data.deleteEnd) {
+        if (data.err) {
+          reject(data.err);
+        } else {
+          preview.token = data.token;
+          resolve(preview);
+        }
+      } else if (data.err) {
+        preview.errors.push({ name: data.name, err: data.err });
+      } else {
+        preview.names.push(data.name);
+      }
+    });
+    stream.on('error', reject);
+  });
+}
+
+/*
+ * Deletes a mount point and the names under it, as listed by
+ * previewDeleteTree.
+ * @param {string} name Name of the mount point.
+ * @param {string} token The token returned by previewDeleteTree.
+ * @return {EventEmitter} Emits 'deleted' with each name deleted, 'failed'
+ * with each name that could not be deleted and its error, then 'end', or
+ * 'error' if the delete failed as a whole.
+ */
+function deleteTree(name, token) {
+  var events = new EventEmitter();
+  var stream = browserd.request('deleteTree', { name: name, token: token });
+  stream.on('data', function(data) {
+    if (data.deleteEnd) {
+      if (data.err) {
+        events.emit('error', data.err);
+      } else {
+        events.emit('end');
+      }
+    } else if (data.err) {
+      events.emit('failed', data.name, data.err);
+    } else {
+      events.emit('deleted', data.name);
+    }
+  });
+  stream.on('error', function(err) {
+    events.emit('error', err);
+  });
+  return events;
+}
+
+/*
+ * Mounts a server at a name.
+ * @param {string} name Name to mount the server at.
+ * @param {string} server Object name or endpoint of the server.
+ * @param {object} [options] ttl {string}, e.g. '10m', with no expiry if
+ * omitted, and the servesMountTable, isLeaf and replace flags {boolean}.
+ * @return {Promise<void>} Success or failure promise.
+ */
+function mount(name, server, options) {
+  var params = extend({}, options, { name: name, server: server });
+  return getSingleEvent('mount', params, 'mount');
+}
+
+/*
+ * Unmounts a server from a name.
+ * @param {string} name Name to unmount the server from.
+ * @param {string} [server] Server to unmount. All of them if omitted.
+ * @return {Promise<void>} Success or failure promise.
+ */
+function unmount(name, server) {
+  var params = { name: name, server: server || '' };
+  return getSingleEvent('unmount', params, 'unmount');
+}
+
 /*
  * Given a name, provide information about its mounttable objectAddress.
  * @param {string} objectName Object name to get mounttable objectAddress for.
@@ -397,6 +676,19 @@ function getRemoteBlessings(objectName) {
   });
 }
 
+/*
+ * Given an object name, returns a promise of the details of the service's
+ * blessings: the certificate chain of each blessing with its caveats and
+ * expiry, and the blessings that we do not accept, with the reasons why.
+ * Unlike getRemoteBlessings, it is not cached, since it is used to debug
+ * authorization failures.
+ * @param {string} objectName Object name to get the blessings of
+ * @return {Promise.<object>} The remoteBlessings response.
+ */
+function getBlessingDetails(objectName) {
+  return getSingleEvent('remoteBlessings', objectName);
+}
+
 /*
  * signatureCache holds (name, signature) cache entry for
  * SIGNATURE_CACHE_MAX_SIZE items in an LRU cache
@@ -461,25 +753,96 @@ function lowercasifyJSONObject(obj) {
  * methodName: string for the service method name
  * args (optional): array of arguments for the service method
  */
-function makeRPC(name, methodName, args, numOutArgs) {
-  log.debug('Calling', methodName, 'on', name, 'with', args, 'for', numOutArgs);
+function makeRPC(name, methodName, args) {
+  log.debug('Calling', methodName, 'on', name, 'with', args);
+  var call = {
+    name: name,
+    methodName: methodName,
+    args: args
+  };
+  return getSingleEvent('makeRPC', call, 'response').then(unwrapOutArgs);
+}
+
+/*
+ * Make an RPC call on a service method that streams.
+ * Returns an EventEmitter that emits 'item' with the value and type of each
+ * item the service sends, then 'end' with the result (as with makeRPC) or
+ * 'error'.
+ * The returned object also has these methods:
+ *   send(item): Promise<void> sends an item to the service.
+ *   closeSend(): Promise<void> tells the service no more items will be sent.
+ *   cancel() stops the call.
+ */
+function makeStreamingRPC(name, methodName, args) {
+  log.debug('Streaming', methodName, 'on', name, 'with', args);
   var call = {
     name: name,
     methodName: methodName,
-    args: args,
-    numOutArgs: numOutArgs
+    args: args
   };
-  return getSingleEvent('makeRPC', call, 'response').then(function (result) {
-    // If the result was for 0 outArg, then this returns undefined.
-    // If the result was for 1 outArg, then it gets a single output.
-    // If the result was for >1 outArgs, then we return []output.
-    if (numOutArgs === 0) {
-      return;
-    } else if (numOutArgs === 1) {
-      return result[0];
+  var events = new EventEmitter();
+
+  // Items can be sent once the daemon has told us the ID of the stream.
+  var resolveStreamId, rejectStreamId;
+  var streamIdPromise = new Promise(function(resolve, reject) {
+    resolveStreamId = resolve;
+    rejectStreamId = reject;
+  });
+  streamIdPromise.catch(function() {}); // Only matters to send and closeSend.
+
+  var stream = browserd.request('streamRPC', call);
+  stream.on('data', function(data) {
+    if (data.streamId) {
+      resolveStreamId(data.streamId);
     }
-    return result;
+    if (data.item) {
+      events.emit('item', data.item.value, data.item.type);
+    }
+    if (data.streamEnd) {
+      rejectStreamId(new Error('The stream has ended'));
+      if (data.err) {
+        events.emit('error', data.err);
+      } else {
+        events.emit('end', unwrapOutArgs(data.response));
+      }
+    }
+  });
+  stream.on('error', function(err) {
+    rejectStreamId(err);
+    events.emit('error', err);
   });
+
+  events.send = function(item) {
+    return streamIdPromise.then(function(streamId) {
+      return getSingleEvent('streamSend', { streamId: streamId, item: item });
+    }).then(function() {});
+  };
+  events.closeSend = function() {
+    return streamIdPromise.then(function(streamId) {
+      return getSingleEvent('streamCloseSend', { streamId: streamId });
+    }).then(function() {});
+  };
+  events.cancel = function() {
+    stream.cancel();
+  };
+  return events;
+}
+
+// Each output is given with its type; only the values are returned.
+// The daemon returns as many outputs as the method signature has out-args.
+// If the result was for 0 outArg, then this returns undefined.
+// If the result was for 1 outArg, then it gets a single output.
+// If the result was for >1 outArgs, then we return []output.
+function unwrapOutArgs(result) {
+  var values = result.map(function(output) {
+    return output.value;
+  });
+  if (values.length === 0) {
+    return;
+  } else if (values.length === 1) {
+    return values[0];
+  }
+  return values;
 }
 
 /*
@@ -564,6 +927,18 @@ function clearCache(parentName) {
   }
 }
 
+/*
+ * Switches the namespace roots of the session, e.g. between the root mount
+ * tables of several deployments. The cached results came from the previous
+ * roots, so they are cleared.
+ * @param {Array<string>} roots Rooted names. If empty, the daemon's default
+ * roots are used.
+ */
+function setRoots(roots) {
+  browserd.setRoots(roots);
+  clearCache();
+}
+
 /*
  * Returns true iff parentName is a parent of childName or is same as childName
  */